@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strconv"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// annotationPrefix prefixes the Service annotations read with -read-annotations
+const annotationPrefix = "endpoint-discovery.io/"
+
+var readAnnotations = flag.Bool("read-annotations", os.Getenv("ENDPOINT_READ_ANNOTATIONS") == "true", "take the format, port, domain and minimum count not set by flags or environment variables from the endpoint-discovery.io/ annotations of the service (env ENDPOINT_READ_ANNOTATIONS)")
+
+// applyServiceAnnotations reads the endpoint-discovery.io/format, port, domain and min-endpoints
+// annotations of the service into the settings that weren't given, flags and environment
+// variables taking precedence
+func applyServiceAnnotations(ctx context.Context, clientset *kubernetes.Clientset, s *settings) {
+	o := &s.options
+	service, err := clientset.CoreV1().Services(o.Namespace).Get(ctx, o.Service, metav1.GetOptions{})
+	if err != nil {
+		log.Warningf("Unable to read the annotations of service %s/%s: %v", o.Namespace, o.Service, err)
+		return
+	}
+	annotation := func(name string) string {
+		value := service.Annotations[annotationPrefix+name]
+		if value != "" {
+			log.Infof("Using %s=%s from the annotations of service %s/%s", name, value, o.Namespace, o.Service)
+		}
+		return value
+	}
+
+	if s.format == "" && s.template == nil && s.jsonPath == nil {
+		if value := annotation("format"); value != "" {
+			if _, err := format.Lookup(value); err != nil {
+				log.Fatalf("Invalid annotation %sformat %q: %v", annotationPrefix, value, err)
+			}
+			s.format = value
+		}
+	}
+	if o.PortName == "" && o.PortNumber == 0 {
+		if value := annotation("port"); value != "" {
+			if _, err := strconv.Atoi(value); err == nil {
+				o.PortNumber = parsePort("annotation "+annotationPrefix+"port", value)
+			} else {
+				o.PortName = value
+			}
+		}
+	}
+	if *domainFlag == "" && !s.domainAuto {
+		if value := annotation("domain"); value != "" {
+			o.Domain = value
+		}
+	}
+	if *minEndpoints == 0 && *waitFor == "" {
+		if value := annotation("min-endpoints"); value != "" {
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 0 {
+				log.Fatalf("Invalid annotation %smin-endpoints %q: must be a non-negative number", annotationPrefix, value)
+			}
+			o.Count = count
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// endpointsCacheFile keeps the endpoints objects of the last successful discovery in a file, so
+// that they can be emitted after a restart while the API server is unreachable or the discovery
+// times out
+type endpointsCacheFile struct {
+	file   *outputFile
+	maxAge time.Duration
+	// loaded is the result read from the file, not written back
+	loaded *discovery.Result
+}
+
+// newEndpointsCacheFile creates the cache file, maxAge 0 accepting a cache of any age
+func newEndpointsCacheFile(path string, maxAge time.Duration) *endpointsCacheFile {
+	if maxAge < 0 {
+		log.Fatalf("-max-cache-age can't be negative")
+	}
+	return &endpointsCacheFile{file: &outputFile{path: path}, maxAge: maxAge}
+}
+
+// save writes the endpoints objects of the result when it met the expected count, as an
+// EndpointsList manifest
+func (c *endpointsCacheFile) save(result *discovery.Result, count int) {
+	if result == c.loaded || result.Err != nil || (!result.Met && count > 0) {
+		return
+	}
+	list := core.EndpointsList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "EndpointsList"}}
+	for _, endpoints := range result.Objects {
+		list.Items = append(list.Items, *endpoints)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		log.Errorf("Unable to encode the endpoints cache: %v", err)
+		return
+	}
+	c.file.write(string(data) + "\n")
+	// the age of the cache is the time of the last successful discovery, even an unchanged one
+	now := time.Now()
+	if err := os.Chtimes(c.file.path, now, now); err != nil {
+		log.Errorf("Unable to update the endpoints cache: %v", err)
+	}
+}
+
+// load reads the cached endpoints objects and discovers the endpoints from them, returning nil
+// when there is no cache, it's older than the maximum age or its endpoints don't meet the
+// expected count without -allow-partial
+func (c *endpointsCacheFile) load(ctx context.Context, opts discovery.Options) *discovery.Result {
+	path := c.file.path
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Warningf("No endpoints cache to fall back to: %v", err)
+		return nil
+	}
+	if age := time.Since(info.ModTime()); c.maxAge > 0 && age > c.maxAge {
+		log.Warningf("Ignoring the endpoints cache %s, %s old", path, age.Round(time.Second))
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Warningf("Unable to read the endpoints cache: %v", err)
+		return nil
+	}
+	defer file.Close()
+	objects, err := discovery.ReadManifests(file, opts.Namespace)
+	if err != nil {
+		log.Warningf("Invalid endpoints cache %s: %v", path, err)
+		return nil
+	}
+	if discovery.ListsServices(opts) {
+		// the services can't be listed without the cluster, take the cached ones
+		for _, endpoints := range objects {
+			opts.Services = append(opts.Services, discovery.ServiceRef{Namespace: endpoints.Namespace, Name: endpoints.Name})
+		}
+	}
+	result := discovery.NewFixtureDiscoverer(objects).Poll(ctx, opts)
+	if len(result.Endpoints) == 0 || (!result.Met && opts.Count > 0 && !*allowPartial) {
+		log.Warningf("The endpoints cache %s doesn't hold the expected endpoints", path)
+		return nil
+	}
+	log.Warningf("Using the %d endpoints cached in %s at %s", len(result.Endpoints), path, info.ModTime().UTC().Format(time.RFC3339))
+	c.loaded = result
+	return result
+}
+
+// isUnreachable reports whether the error is a failure to reach the API server rather than an
+// answer of it
+func isUnreachable(err error) bool {
+	var status apierrors.APIStatus
+	return err != nil && !errors.As(err, &status)
+}
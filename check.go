@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	authorization "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// checkCommand is the subcommand that verifies the RBAC permissions of the settings instead of
+// discovering the endpoints
+const checkCommand = "check"
+
+// permission is an API access the settings need
+type permission struct {
+	verb          string
+	group         string
+	resource      string
+	namespaceName string
+}
+
+func (p permission) String() string {
+	resource := p.resource
+	if p.group != "" {
+		resource += "." + p.group
+	}
+	namespaceName := p.namespaceName
+	if namespaceName == "" {
+		namespaceName = "all namespaces"
+	}
+	return fmt.Sprintf("%s %s in %s", p.verb, resource, namespaceName)
+}
+
+// requiredPermissions lists the permissions discovery needs with the settings: reading the
+// endpoints of the services and the other objects the enabled features read or write
+func requiredPermissions(s *settings) []permission {
+	namespaces := []string{s.options.Namespace}
+	if len(s.options.Services) > 0 {
+		namespaces = []string{}
+		seen := map[string]bool{}
+		for _, service := range s.options.Services {
+			if !seen[service.Namespace] {
+				seen[service.Namespace] = true
+				namespaces = append(namespaces, service.Namespace)
+			}
+		}
+	} else if s.options.AllNamespaces {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	permissions := []permission{}
+	add := func(group string, resource string, verbs ...string) {
+		for _, namespaceName := range namespaces {
+			for _, verb := range verbs {
+				permissions = append(permissions, permission{verb: verb, group: group, resource: resource, namespaceName: namespaceName})
+			}
+		}
+	}
+	switch {
+	case s.options.PodSelector != nil:
+		add("", "pods", "list", "watch")
+	case s.options.LoadBalancer:
+		add("", "services", "get", "list", "watch")
+	case s.options.Backend == discovery.BackendDNS:
+	case s.options.Backend == discovery.BackendEndpointSlices:
+		add("discovery.k8s.io", "endpointslices", "get", "list", "watch")
+	default:
+		add("", "endpoints", "get", "list", "watch")
+	}
+	if discovery.ListsServices(s.options) {
+		if *watchMode || *hold {
+			// the Services listed are cached too
+			add("", "services", "list", "watch")
+		} else {
+			add("", "services", "list")
+		}
+	}
+	if *readAnnotations {
+		add("", "services", "get")
+	}
+	if s.waitFor != nil && s.waitFor.statefulSet != "" {
+		add("apps", "statefulsets", "get", "list")
+	}
+	if s.emitEvents {
+		add("", "events", "create", "patch")
+	}
+	if s.options.Zone != "" || s.options.NodeSelector != nil {
+		permissions = append(permissions, permission{verb: "get", resource: "nodes"})
+	}
+	if s.mirrorTo != nil {
+		for _, verb := range []string{"get", "create", "update"} {
+			permissions = append(permissions, permission{verb: verb, resource: "endpoints", namespaceName: s.mirrorTo.namespaceName})
+		}
+	}
+	targets := []*configMapTarget{}
+	if s.configMap != nil {
+		targets = append(targets, s.configMap)
+	}
+	for _, sink := range s.sinks {
+		if sink.configMap != nil {
+			targets = append(targets, sink.configMap)
+		}
+	}
+	for _, target := range targets {
+		for _, verb := range []string{"get", "create", "update"} {
+			permissions = append(permissions, permission{verb: verb, resource: "configmaps", namespaceName: target.namespaceName})
+		}
+	}
+	if s.readiness != nil {
+		permissions = append(permissions, permission{verb: "patch", resource: "pods/status", namespaceName: s.readiness.namespaceName})
+	}
+	if s.leader != nil {
+		for _, verb := range []string{"get", "create", "update"} {
+			permissions = append(permissions, permission{verb: verb, group: "coordination.k8s.io", resource: "leases", namespaceName: s.leader.namespaceName})
+		}
+	}
+	return permissions
+}
+
+// checkPermissions reviews every required permission with a SelfSubjectAccessReview, printing
+// the missing ones, and exits with exitMissingPermissions when any is missing
+func checkPermissions(ctx context.Context, clientset *kubernetes.Clientset, s *settings) {
+	missing := []string{}
+	for _, p := range requiredPermissions(s) {
+		review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorization.SelfSubjectAccessReview{
+			Spec: authorization.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorization.ResourceAttributes{
+					Namespace: p.namespaceName,
+					Verb:      p.verb,
+					Group:     p.group,
+					Resource:  p.resource,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			log.Errorf("Unable to review the permission to %s: %v", p, err)
+			os.Exit(exitAPIError)
+		}
+		if !review.Status.Allowed {
+			missing = append(missing, p.String())
+			continue
+		}
+		log.Debug("Permission granted", "permission", p.String())
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stdout, "Missing permissions:\n  %s\n", strings.Join(missing, "\n  "))
+		os.Exit(exitMissingPermissions)
+	}
+	fmt.Fprintln(os.Stdout, "All permissions granted")
+}
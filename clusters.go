@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"k8s.io/client-go/kubernetes"
+)
+
+// clusterContext is a kubeconfig context to aggregate endpoints from, with an optional domain
+type clusterContext struct {
+	name   string
+	domain string
+}
+
+// parseContexts parses a comma separated list of context[=domain] entries
+func parseContexts(value string) []clusterContext {
+	contexts := []clusterContext{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		c := clusterContext{name: item}
+		if i := strings.Index(item, "="); i >= 0 {
+			c.name, c.domain = item[:i], item[i+1:]
+		}
+		if c.name == "" {
+			log.Fatalf("Invalid -contexts %q: context name is empty", value)
+		}
+		contexts = append(contexts, c)
+	}
+	return contexts
+}
+
+// buildClusters creates a discoverer for each kubeconfig context
+func buildClusters(kubeconfig string, contexts []clusterContext) []discovery.Cluster {
+	clusters := []discovery.Cluster{}
+	for _, c := range contexts {
+		clientset, err := kubernetes.NewForConfig(buildConfig(kubeconfig, c.name))
+		if err != nil {
+			log.Fatalf("Unable to create the Kubernetes client of context %s: %v", c.name, err)
+		}
+		clusters = append(clusters, discovery.Cluster{
+			Name:       c.name,
+			Discoverer: discovery.NewDiscoverer(clientset),
+			Domain:     c.domain,
+		})
+	}
+	return clusters
+}
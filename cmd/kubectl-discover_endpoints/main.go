@@ -0,0 +1,99 @@
+/*
+
+Command kubectl-discover_endpoints is the kubectl plugin of the tool: kubectl discover-endpoints
+reads the endpoints of services once, with the kubeconfig, context and namespace handling of
+kubectl, and renders them in any of the output formats.
+
+	kubectl discover-endpoints svc/zookeeper -n infra --format json
+
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+)
+
+func main() {
+	flags := pflag.NewFlagSet("kubectl-discover_endpoints", pflag.ExitOnError)
+	configFlags := genericclioptions.NewConfigFlags(true)
+	configFlags.AddFlags(flags)
+	formatName := flags.String("format", "default", "output format")
+	portName := flags.String("port-name", "", "port of multi-port services")
+	addressType := flags.String("address-type", "", "hostname (default), ip, or auto to use the IP of addresses without a hostname")
+	backend := flags.String("backend", "auto", "endpoints, endpointslices or auto to use EndpointSlices when served")
+	domain := flags.String("domain", "cluster.local", "cluster domain of the FQDNs")
+	includeNotReady := flags.Bool("include-not-ready", false, "also list the not-ready addresses")
+	logLevel := flags.String("log-level", "warn", "minimum level of the messages written to stderr")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: kubectl discover-endpoints [svc/]NAME... [flags]\n\n%s", flags.FlagUsages())
+	}
+	flags.Parse(os.Args[1:])
+	if err := log.Setup(os.Stderr, *logLevel, "text"); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	namespaceName, _, err := configFlags.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		log.Fatalf("Unable to find the namespace: %v", err)
+	}
+	opts := discovery.Options{
+		Namespace:       namespaceName,
+		Domain:          *domain,
+		PortName:        *portName,
+		AddressType:     *addressType,
+		IncludeNotReady: *includeNotReady,
+	}
+	for _, arg := range flags.Args() {
+		name := arg
+		if i := strings.Index(arg, "/"); i >= 0 {
+			if kind := arg[:i]; kind != "svc" && kind != "service" && kind != "services" {
+				log.Fatalf("Invalid argument %q: must be a service name or svc/NAME", arg)
+			}
+			name = arg[i+1:]
+		}
+		opts.Services = append(opts.Services, discovery.ServiceRef{Namespace: namespaceName, Name: name})
+	}
+	formatter, err := format.LookupWriter(*formatName)
+	if err != nil {
+		log.Fatalf("Invalid --format %q: %v", *formatName, err)
+	}
+
+	config, err := configFlags.ToRESTConfig()
+	if err != nil {
+		log.Fatalf("Unable to load the kubeconfig: %v", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("Unable to create the Kubernetes client: %v", err)
+	}
+	opts.Backend = discovery.ResolveBackend(clientset, *backend)
+	ctx := context.Background()
+	discoverer := discovery.NewDiscoverer(clientset)
+	result := discoverer.Poll(ctx, opts)
+	if result.Err != nil {
+		log.Fatalf("Unable to read the endpoints: %v", result.Err)
+	}
+	err = formatter(os.Stdout, result.Endpoints, format.Options{
+		Zone: func(endpoint discovery.Endpoint) string {
+			return discoverer.EndpointZone(ctx, endpoint)
+		},
+	})
+	if err != nil {
+		log.Fatalf("Unable to render the output: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// gzipOutput compresses the output, the same output always giving the same bytes as the gzip
+// header carries no name nor modification time
+func gzipOutput(output string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write([]byte(output))
+	w.Close()
+	return b.Bytes()
+}
+
+// gunzipOutput decompresses the output written by gzipOutput, returning nil when it isn't gzipped
+func gunzipOutput(data []byte) []byte {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	output, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+	return output
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+var configFile = flag.String("config", os.Getenv("ENDPOINT_CONFIG"), "YAML file of settings keyed by flag name, with an env map for the settings without a flag; flags and environment variables override it (env ENDPOINT_CONFIG)")
+
+// flagEnvRe matches the environment variables a flag falls back to, as documented in its usage
+var flagEnvRe = regexp.MustCompile(`\(env ([A-Z0-9_, or]+)\)`)
+
+// flagEnv returns the environment variables the flag falls back to
+func flagEnv(f *flag.Flag) []string {
+	match := flagEnvRe.FindStringSubmatch(f.Usage)
+	if match == nil {
+		return nil
+	}
+	return strings.Fields(strings.NewReplacer(",", " ", " or ", " ").Replace(match[1]))
+}
+
+// applyConfigFile sets the flags from the config file that were given neither on the command
+// line nor through their environment variables, and the environment variables of its env map
+// that aren't set
+func applyConfigFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Unable to read -config: %v", err)
+	}
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		log.Fatalf("Invalid -config %q: %v", path, err)
+	}
+
+	flagEnvs := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		for _, name := range flagEnv(f) {
+			flagEnvs[name] = f.Name
+		}
+	})
+	if env, ok := config["env"]; ok {
+		values, ok := env.(map[string]interface{})
+		if !ok {
+			log.Fatalf("Invalid -config %q: env must map environment variables to values", path)
+		}
+		for name, value := range values {
+			if flagName, ok := flagEnvs[name]; ok {
+				log.Fatalf("Invalid -config %q: set %s with the %s key", path, name, flagName)
+			}
+			if _, set := os.LookupEnv(name); !set {
+				os.Setenv(name, configValue(value))
+			}
+		}
+		delete(config, "env")
+	}
+
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range config {
+		f := flag.Lookup(name)
+		if f == nil || name == "config" {
+			log.Fatalf("Invalid -config %q: unknown setting %s", path, name)
+		}
+		if given[name] || envSet(flagEnv(f)) {
+			continue
+		}
+		if err := f.Value.Set(configValue(value)); err != nil {
+			log.Fatalf("Invalid -config %q: %s: %v", path, name, err)
+		}
+	}
+}
+
+// configValue returns the flag value of a config setting, joining lists with commas
+func configValue(value interface{}) string {
+	switch value := value.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case []interface{}:
+		items := []string{}
+		for _, item := range value {
+			items = append(items, configValue(item))
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// envSet reports whether any of the environment variables is set
+func envSet(names []string) bool {
+	for _, name := range names {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
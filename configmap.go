@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultConfigMapKey is the ConfigMap key the output is written to when the target doesn't name one
+const defaultConfigMapKey = "endpoints"
+
+// configMapTarget is the ConfigMap key the rendered output is published to. With leader election
+// the publications go through the leaderLease of the settings, like every shared output.
+type configMapTarget struct {
+	namespaceName string
+	name          string
+	key           string
+	// gzip writes the compressed output to the binaryData of the ConfigMap instead of its data
+	gzip bool
+
+	clientset kubernetes.Interface
+}
+
+// parseConfigMapTarget parses a namespace/name[:key] reference
+func parseConfigMapTarget(value string) (*configMapTarget, error) {
+	ref, key := value, defaultConfigMapKey
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		ref, key = value[:i], value[i+1:]
+	}
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || key == "" {
+		return nil, fmt.Errorf("must be namespace/name[:key]")
+	}
+	return &configMapTarget{namespaceName: parts[0], name: parts[1], key: key}, nil
+}
+
+// start sets the client the ConfigMap is written with
+func (t *configMapTarget) start(clientset kubernetes.Interface) {
+	t.clientset = clientset
+}
+
+// publish writes the output to the ConfigMap
+func (t *configMapTarget) publish(ctx context.Context, output string) {
+	t.write(ctx, output)
+}
+
+// write creates or updates the ConfigMap so that its key holds the output
+func (t *configMapTarget) write(ctx context.Context, output string) {
+	client := t.clientset.CoreV1().ConfigMaps(t.namespaceName)
+	existing, err := client.Get(ctx, t.name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		configMap := &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: t.name, Namespace: t.namespaceName}}
+		t.set(configMap, output)
+		_, err = client.Create(ctx, configMap, metav1.CreateOptions{})
+	case err == nil:
+		if !t.set(existing, output) {
+			return
+		}
+		_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if errors.IsForbidden(err) {
+		log.Fatalf("Writing the ConfigMap %s/%s is forbidden, grant get, create and update on configmaps in %s: %v",
+			t.namespaceName, t.name, t.namespaceName, err)
+	}
+	if err != nil {
+		log.Errorf("Unable to publish the ConfigMap %s/%s: %v", t.namespaceName, t.name, err)
+		return
+	}
+	log.Infof("Published the output to the ConfigMap %s/%s key %s", t.namespaceName, t.name, t.key)
+}
+
+// set stores the output under the key of the ConfigMap, in its binaryData with gzip, and reports
+// whether it changed. A key can't be in both data and binaryData, so the other one is removed.
+func (t *configMapTarget) set(configMap *core.ConfigMap, output string) bool {
+	if t.gzip {
+		data := gzipOutput(output)
+		_, stale := configMap.Data[t.key]
+		if current, ok := configMap.BinaryData[t.key]; ok && !stale && bytes.Equal(current, data) {
+			return false
+		}
+		delete(configMap.Data, t.key)
+		if configMap.BinaryData == nil {
+			configMap.BinaryData = map[string][]byte{}
+		}
+		configMap.BinaryData[t.key] = data
+		return true
+	}
+	_, stale := configMap.BinaryData[t.key]
+	if current, ok := configMap.Data[t.key]; ok && !stale && current == output {
+		return false
+	}
+	delete(configMap.BinaryData, t.key)
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[t.key] = output
+	return true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"k8s.io/client-go/rest"
+)
+
+var apiServer = flag.String("server", os.Getenv("ENDPOINT_API_SERVER"), "URL of the API server, or of a proxy to it, used instead of the kubeconfig and the in-cluster configuration (env ENDPOINT_API_SERVER)")
+
+var tokenFile = flag.String("token-file", os.Getenv("ENDPOINT_TOKEN_FILE"), "file holding the bearer token to authenticate with, re-read when it changes, e.g. a projected service account token (env ENDPOINT_TOKEN_FILE)")
+
+var certificateAuthority = flag.String("certificate-authority", os.Getenv("ENDPOINT_CERTIFICATE_AUTHORITY"), "file holding the CA certificates of the API server (env ENDPOINT_CERTIFICATE_AUTHORITY)")
+
+var insecureSkipTLSVerify = flag.Bool("insecure-skip-tls-verify", os.Getenv("ENDPOINT_INSECURE_SKIP_TLS_VERIFY") == "true", "don't verify the certificate of the API server, for testing only (env ENDPOINT_INSECURE_SKIP_TLS_VERIFY)")
+
+// serviceAccountCAFile is the CA the in-cluster configuration trusts
+const serviceAccountCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
+// explicitConfig returns the configuration of -server, or the in-cluster one with the -token-file
+// token, which rest.InClusterConfig can't read from another path, or nil to load it as usual
+func explicitConfig(inCluster bool) *rest.Config {
+	if *apiServer != "" {
+		return &rest.Config{Host: *apiServer}
+	}
+	if inCluster && *tokenFile != "" {
+		return &rest.Config{
+			Host:            "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")),
+			TLSClientConfig: rest.TLSClientConfig{CAFile: serviceAccountCAFile},
+		}
+	}
+	return nil
+}
+
+// withCredentials applies -token-file, -certificate-authority and -insecure-skip-tls-verify over
+// the credentials of the configuration. The proxy of HTTPS_PROXY, with the NO_PROXY exceptions,
+// is used by the client unless the kubeconfig sets a proxy-url.
+func withCredentials(config *rest.Config) *rest.Config {
+	if *tokenFile != "" {
+		config.BearerToken = ""
+		config.BearerTokenFile = *tokenFile
+		config.Username, config.Password = "", ""
+		config.ExecProvider, config.AuthProvider = nil, nil
+	}
+	if *certificateAuthority != "" {
+		config.TLSClientConfig.CAFile = *certificateAuthority
+		config.TLSClientConfig.CAData = nil
+	}
+	if *insecureSkipTLSVerify {
+		log.Warningf("Not verifying the certificate of the API server %s", config.Host)
+		// client-go refuses a CA along with an insecure connection
+		config.TLSClientConfig.Insecure = true
+		config.TLSClientConfig.CAFile = ""
+		config.TLSClientConfig.CAData = nil
+	}
+	return config
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// dependency is a service that must reach a ready endpoint count before the primary service is discovered
+type dependency struct {
+	namespaceName string
+	serviceName   string
+	count         int
+}
+
+// parseDependency parses a [namespace/]service:count reference, defaulting to the primary namespace
+func parseDependency(value string, namespaceName string) *dependency {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		log.Fatalf("Invalid ENDPOINT_DEPENDS_ON %q: must be [namespace/]service:count", value)
+	}
+	count, err := strconv.Atoi(value[i+1:])
+	if err != nil || count < 1 {
+		log.Fatalf("Invalid ENDPOINT_DEPENDS_ON %q: count must be a positive number", value)
+	}
+	d := &dependency{namespaceName: namespaceName, serviceName: value[:i], count: count}
+	if j := strings.Index(d.serviceName, "/"); j >= 0 {
+		d.namespaceName, d.serviceName = d.serviceName[:j], d.serviceName[j+1:]
+	}
+	if d.serviceName == "" {
+		log.Fatalf("Invalid ENDPOINT_DEPENDS_ON %q: service name is empty", value)
+	}
+	return d
+}
+
+// waitForDependency waits until the dependency service has at least the required number
+// of ready addresses or the context is done
+func waitForDependency(ctx context.Context, discoverer *discovery.Discoverer, s *settings) {
+	d := s.dependency
+	if err := discoverer.WaitForCount(ctx, s.options, d.namespaceName, d.serviceName, d.count); err != nil {
+		log.Warningf("Stopped waiting for dependency %s/%s: %v", d.namespaceName, d.serviceName, err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcore "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// eventNotifier records discovery milestones as Events on the target Service
+type eventNotifier struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	ref         *core.ObjectReference
+	pending     sync.WaitGroup
+}
+
+// eventSink forwards events to the API server, warning once when event creation is forbidden
+type eventSink struct {
+	record.EventSink
+	notifier  *eventNotifier
+	forbidden sync.Once
+	mu        sync.Mutex
+	attempted map[*core.Event]bool
+}
+
+// done marks the first write attempt of an event; retries and patch fallbacks reuse the same pointer
+func (s *eventSink) done(event *core.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.attempted[event] {
+		s.attempted[event] = true
+		s.notifier.pending.Done()
+	}
+}
+
+func (s *eventSink) Create(event *core.Event) (*core.Event, error) {
+	defer s.done(event)
+	created, err := s.EventSink.Create(event)
+	if errors.IsForbidden(err) {
+		s.forbidden.Do(func() {
+			log.Warningf("Creating events is forbidden, discovery milestones are only logged: %v", err)
+		})
+	}
+	return created, err
+}
+
+func (s *eventSink) Patch(event *core.Event, data []byte) (*core.Event, error) {
+	defer s.done(event)
+	return s.EventSink.Patch(event, data)
+}
+
+// newEventNotifier starts recording events referencing the service; milestones are always logged as well
+func newEventNotifier(ctx context.Context, clientset *kubernetes.Clientset, namespaceName string, serviceName string) *eventNotifier {
+	ref := &core.ObjectReference{Kind: "Service", APIVersion: "v1", Namespace: namespaceName, Name: serviceName}
+	if service, err := clientset.CoreV1().Services(namespaceName).Get(ctx, serviceName, metav1.GetOptions{}); err == nil {
+		ref.UID = service.UID
+		ref.ResourceVersion = service.ResourceVersion
+	}
+	n := &eventNotifier{broadcaster: record.NewBroadcaster(), ref: ref}
+	n.broadcaster.StartLogging(log.Infof)
+	n.broadcaster.StartRecordingToSink(&eventSink{
+		EventSink: &typedcore.EventSinkImpl{Interface: clientset.CoreV1().Events(namespaceName)},
+		notifier:  n,
+		attempted: map[*core.Event]bool{},
+	})
+	n.recorder = n.broadcaster.NewRecorder(scheme.Scheme, core.EventSource{Component: "kube-endpoint-discovery"})
+	return n
+}
+
+// record posts a milestone event on the service
+func (n *eventNotifier) record(eventType string, reason string, messageFmt string, args ...interface{}) {
+	n.pending.Add(1)
+	n.recorder.Eventf(n.ref, eventType, reason, messageFmt, args...)
+}
+
+// close waits a bounded time for the recorded events to be sent
+func (n *eventNotifier) close() {
+	done := make(chan struct{})
+	go func() {
+		n.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		log.Warningf("Timed out sending discovery events")
+	}
+	n.broadcaster.Shutdown()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// execPlaceholder is replaced in the command arguments by the comma separated endpoints
+const execPlaceholder = "{{endpoints}}"
+
+// execCommand replaces the process with the command, passing the endpoints through the
+// environment variable and substituting them for the placeholder in the arguments. The variable
+// suffixed with _PARTIAL is set to true when the count wasn't reached.
+func execCommand(args []string, envName string, hosts []string, partial bool) {
+	joined := strings.Join(hosts, ",")
+	argv := []string{}
+	for _, arg := range args {
+		argv = append(argv, strings.Replace(arg, execPlaceholder, joined, -1))
+	}
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		log.Fatalf("Unable to exec %s: %v", argv[0], err)
+	}
+	log.Infof("Executing %s", strings.Join(argv, " "))
+	env := append(os.Environ(), envName+"="+joined)
+	if partial {
+		env = append(env, envName+"_PARTIAL=true")
+	}
+	if err := replaceProcess(path, argv, env); err != nil {
+		log.Fatalf("Unable to exec %s: %v", path, err)
+	}
+}
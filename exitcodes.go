@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"os"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Exit codes reported when discovery fails without -allow-partial
+const (
+	exitTimeout  = 2
+	exitNotFound = 3
+	exitAPIError = 4
+	// exitMissingPermissions is returned by the check subcommand
+	exitMissingPermissions = 5
+)
+
+// exitFailed logs why the expected endpoints weren't discovered and exits with the matching code
+func exitFailed(result *discovery.Result, count int) {
+	switch {
+	case result.Err == nil:
+		log.Errorf("Timed out with %d of %d endpoints", len(result.Endpoints), count)
+		os.Exit(exitTimeout)
+	case errors.IsForbidden(result.Err) || errors.IsUnauthorized(result.Err):
+		log.Errorf("Permission denied, the check subcommand lists the missing permissions: %v", result.Err)
+		os.Exit(exitAPIError)
+	case errors.IsNotFound(result.Err):
+		log.Errorf("Service not found: %v", result.Err)
+		os.Exit(exitNotFound)
+	default:
+		log.Errorf("Unable to read the endpoints: %v", result.Err)
+		os.Exit(exitAPIError)
+	}
+}
+
+// acceptPartial reports whether the endpoints found when discovery timed out are emitted anyway:
+// with -allow-partial, or when they reach the -min-ratio of the expected count
+func acceptPartial(result *discovery.Result, s *settings) bool {
+	if *allowPartial {
+		return true
+	}
+	if s.minRatio == 0 || result.Err != nil {
+		return false
+	}
+	required := int(math.Ceil(s.minRatio * float64(s.options.Count)))
+	if len(result.Endpoints) < required {
+		log.Errorf("Found %d of %d endpoints, %d required by -min-ratio", len(result.Endpoints), s.options.Count, required)
+		return false
+	}
+	log.Warningf("Timed out with %d of %d endpoints, emitting them as a partial result", len(result.Endpoints), s.options.Count)
+	return true
+}
+
+// isPartial reports whether the result is emitted without reaching the expected count
+func isPartial(result *discovery.Result, count int) bool {
+	return !result.Met && count > 0
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// validateFixture rejects the settings that need the cluster when the endpoints are read from
+// a manifest
+func validateFixture(s *settings) {
+	o := s.options
+	conflicts := []string{}
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"-service-selector", o.ServiceSelector != ""},
+		{"ENDPOINT_SERVICE_REGEX", o.ServiceRegex != nil},
+		{"-all-namespaces", o.AllNamespaces},
+		{"-backend dns", o.Backend == discovery.BackendDNS},
+		{"-pod-selector", o.PodSelector != nil},
+		{"-read-annotations", *readAnnotations},
+		{"-zone", o.Zone != ""},
+		{"-node-selector", o.NodeSelector != nil},
+		{"ENDPOINT_MEMBER_ANNOTATION", o.MemberAnnotation != ""},
+		{"-hold or -watch", *hold || *watchMode},
+		{"-contexts", len(s.contexts) > 0},
+		{"-wait-for on a StatefulSet", s.waitFor != nil && s.waitFor.statefulSet != ""},
+		{"ENDPOINT_DEPENDS_ON", s.dependency != nil},
+		{"ENDPOINT_DOMAIN_AUTO", s.domainAuto},
+		{"ENDPOINT_EMIT_EVENTS", s.emitEvents},
+		{"ENDPOINT_MIRROR_TO", s.mirrorTo != nil},
+		{"-publish-configmap or an -output ConfigMap", s.publishesConfigMap()},
+	} {
+		if setting.set {
+			conflicts = append(conflicts, setting.name)
+		}
+	}
+	if len(conflicts) > 0 {
+		log.Fatalf("-from-file can't be combined with settings reading or writing the cluster: %s", strings.Join(conflicts, ", "))
+	}
+}
+
+// emitFixture runs the formatting pipeline on the endpoints of a manifest, without cluster access
+func emitFixture(path string, s *settings) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Unable to open -from-file: %v", err)
+		}
+		defer file.Close()
+		r = file
+	}
+	objects, err := discovery.ReadManifests(r, s.options.Namespace)
+	if err != nil {
+		log.Fatalf("Invalid -from-file %q: %v", path, err)
+	}
+	ctx := context.Background()
+	discoverer := discovery.NewFixtureDiscoverer(objects)
+	result := discoverer.Poll(ctx, s.options)
+	if *validateTemplate {
+		renderTemplateAndExit(s, result.Endpoints)
+	}
+	if !result.Met && !acceptPartial(result, s) {
+		exitFailed(result, s.options.Count)
+	}
+	log.Infof("Endpoints = %s", discovery.Names(result.Endpoints))
+	emit(ctx, nil, discoverer, result, s)
+	if s.redis != nil {
+		s.redis.close()
+	}
+	if s.webhook != nil {
+		s.webhook.close()
+	}
+	if *execMode {
+		execCommand(flag.Args(), *execEnv, discovery.Names(result.Endpoints), isPartial(result, s.options.Count))
+	}
+}
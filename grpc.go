@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+var grpcAddress = flag.String("grpc-address", os.Getenv("ENDPOINT_GRPC_ADDRESS"), "address the serve subcommand also serves the endpoints over gRPC on, e.g. :8081 (env ENDPOINT_GRPC_ADDRESS)")
+
+// discoveryService is the endpointdiscovery.v1.Discovery service of proto/discovery/v1/discovery.proto
+type discoveryService interface {
+	getEndpoints(ctx context.Context, request *getEndpointsRequest) (*endpointList, error)
+	watchEndpoints(request *getEndpointsRequest, stream grpc.ServerStream) error
+}
+
+// discoveryServiceDesc describes the Discovery service to the gRPC server. The server is created
+// without interceptors, so the unary handler calls the method directly.
+var discoveryServiceDesc = grpc.ServiceDesc{
+	ServiceName: "endpointdiscovery.v1.Discovery",
+	HandlerType: (*discoveryService)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "GetEndpoints",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			request := &getEndpointsRequest{}
+			if err := dec(request); err != nil {
+				return nil, err
+			}
+			return srv.(discoveryService).getEndpoints(ctx, request)
+		},
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "WatchEndpoints",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			request := &getEndpointsRequest{}
+			if err := stream.RecvMsg(request); err != nil {
+				return err
+			}
+			return srv.(discoveryService).watchEndpoints(request, stream)
+		},
+	}},
+	Metadata: "proto/discovery/v1/discovery.proto",
+}
+
+// grpcServer answers the Discovery calls from the informer cache of the serve subcommand,
+// waking the watch streams up on every change of the cache
+type grpcServer struct {
+	endpoints *endpointServer
+	mu        sync.Mutex
+	watchers  map[chan struct{}]bool
+}
+
+// serveGRPC serves the Discovery service on the address until the context is done
+func serveGRPC(ctx context.Context, endpoints *endpointServer, address string) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatalf("Unable to serve gRPC on %s: %v", address, err)
+	}
+	g := &grpcServer{endpoints: endpoints, watchers: map[chan struct{}]bool{}}
+	if err := endpoints.discoverer.OnCacheChange(g.notify); err != nil {
+		log.Fatalf("Unable to serve gRPC on %s: %v", address, err)
+	}
+	server := grpc.NewServer(grpc.ForceServerCodec(protoCodec{}))
+	server.RegisterService(&discoveryServiceDesc, g)
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+	log.Infof("Serving the endpoints over gRPC on %s", address)
+	if err := server.Serve(listener); err != nil {
+		log.Errorf("Unable to serve gRPC on %s: %v", address, err)
+	}
+}
+
+// getEndpoints returns the endpoints of the requested service
+func (g *grpcServer) getEndpoints(ctx context.Context, request *getEndpointsRequest) (*endpointList, error) {
+	e := g.endpoints
+	namespaceName := request.namespace
+	if namespaceName == "" {
+		namespaceName = e.s.options.Namespace
+	}
+	switch {
+	case request.service == "":
+		return nil, status.Error(codes.InvalidArgument, "service is required")
+	case !e.serves(namespaceName):
+		return nil, status.Errorf(codes.NotFound, "namespace %s isn't served", namespaceName)
+	}
+	endpoints, err := e.discoverer.ServiceEndpoints(ctx, e.s.options, namespaceName, request.service)
+	if errors.IsNotFound(err) {
+		return nil, status.Errorf(codes.NotFound, "service %s/%s not found", namespaceName, request.service)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &endpointList{endpoints: endpoints}, nil
+}
+
+// watchEndpoints sends the endpoints of the requested service, then again whenever they change,
+// an empty list standing for a service not created yet
+func (g *grpcServer) watchEndpoints(request *getEndpointsRequest, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	if request.namespace == "" {
+		request.namespace = g.endpoints.s.options.Namespace
+	}
+	changes := g.subscribe()
+	defer g.unsubscribe(changes)
+	var last []byte
+	sent := false
+	for {
+		list, err := g.getEndpoints(ctx, request)
+		if status.Code(err) == codes.NotFound && request.service != "" && g.endpoints.serves(request.namespace) {
+			list, err = &endpointList{}, nil
+		}
+		if err != nil {
+			return err
+		}
+		if data := list.marshal(); !sent || !bytes.Equal(data, last) {
+			if err := stream.SendMsg(list); err != nil {
+				return err
+			}
+			last, sent = data, true
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		}
+	}
+}
+
+// subscribe returns a channel signalled after every change of the cache
+func (g *grpcServer) subscribe() chan struct{} {
+	changes := make(chan struct{}, 1)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.watchers[changes] = true
+	return changes
+}
+
+// unsubscribe stops signalling the channel
+func (g *grpcServer) unsubscribe(changes chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.watchers, changes)
+}
+
+// notify signals the watch streams, a stream not done with the previous change reading the
+// endpoints once for both
+func (g *grpcServer) notify() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for changes := range g.watchers {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// getEndpointsRequest is the GetEndpointsRequest message
+type getEndpointsRequest struct {
+	namespace string
+	service   string
+}
+
+// endpointList is the EndpointList message
+type endpointList struct {
+	endpoints []discovery.Endpoint
+}
+
+// protoCodec encodes the messages of the Discovery service in the protobuf wire format
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return "proto"
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	list, ok := v.(*endpointList)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response message %T", v)
+	}
+	return list.marshal(), nil
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	request, ok := v.(*getEndpointsRequest)
+	if !ok {
+		return fmt.Errorf("unexpected request message %T", v)
+	}
+	return request.unmarshal(data)
+}
+
+// unmarshal decodes the request, skipping the unknown fields
+func (r *getEndpointsRequest) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ == protowire.BytesType && (num == 1 || num == 2) {
+			value, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if num == 1 {
+				r.namespace = value
+			} else {
+				r.service = value
+			}
+			b = b[n:]
+			continue
+		}
+		if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// marshal encodes the endpoint list, leaving out the fields with default values like proto3 does
+func (l *endpointList) marshal() []byte {
+	var b []byte
+	for _, endpoint := range l.endpoints {
+		var e []byte
+		e = appendString(e, 1, endpoint.Hostname)
+		e = appendString(e, 2, endpoint.FQDN)
+		e = appendString(e, 3, endpoint.IP)
+		e = appendInt32(e, 4, endpoint.Port)
+		for _, port := range endpoint.Ports {
+			var p []byte
+			p = appendString(p, 1, port.Name)
+			p = appendInt32(p, 2, port.Port)
+			p = appendString(p, 3, port.Protocol)
+			e = appendMessage(e, 5, p)
+		}
+		e = appendString(e, 6, endpoint.NodeName)
+		e = appendString(e, 7, endpoint.PodName)
+		e = appendString(e, 8, endpoint.Namespace)
+		e = appendString(e, 9, endpoint.Service)
+		if endpoint.Ready {
+			e = protowire.AppendTag(e, 10, protowire.VarintType)
+			e = protowire.AppendVarint(e, 1)
+		}
+		b = appendMessage(b, 1, e)
+	}
+	return b
+}
+
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendInt32(b []byte, num protowire.Number, value int32) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(value))
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
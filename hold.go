@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"k8s.io/client-go/kubernetes"
+)
+
+// withTermination returns a context cancelled when SIGTERM or SIGINT is received
+func withTermination(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		defer signal.Stop(stop)
+		select {
+		case <-stop:
+			log.Infof("Received termination signal, exiting")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// endpointsKey identifies the endpoints by name, address, ports, node and readiness, so that a
+// pod recreated with another IP under the same hostname is re-emitted
+func endpointsKey(endpoints []discovery.Endpoint) string {
+	var b strings.Builder
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(&b, "%s %v %v %s %t,", endpoint.FQDN, endpoint.IPs, endpoint.Ports, endpoint.NodeName, endpoint.Ready)
+	}
+	return b.String()
+}
+
+// emitSchedule decides when the pending change of the endpoints is emitted: once they stayed
+// unchanged for debounce, but no later than interval after the first change pending, and no
+// sooner than interval after the last emit. The latest change is always emitted eventually.
+type emitSchedule struct {
+	debounce time.Duration
+	interval time.Duration
+
+	pending      bool
+	pendingSince time.Time
+	lastChange   time.Time
+	lastEmit     time.Time
+}
+
+// change records a change of the endpoints and returns the delay until it's due
+func (e *emitSchedule) change(now time.Time) time.Duration {
+	if !e.pending {
+		e.pending, e.pendingSince = true, now
+	}
+	e.lastChange = now
+	return e.due().Sub(now)
+}
+
+// due returns the time the pending change is emitted at
+func (e *emitSchedule) due() time.Time {
+	due := e.lastChange.Add(e.debounce)
+	if e.interval > 0 {
+		// under steady churn the quiet period never comes
+		if maxWait := e.pendingSince.Add(e.interval); maxWait.Before(due) {
+			due = maxWait
+		}
+		if next := e.lastEmit.Add(e.interval); next.After(due) {
+			due = next
+		}
+	}
+	return due
+}
+
+// done clears the pending change, rate limiting the next emit when it was written
+func (e *emitSchedule) done(now time.Time, written bool) {
+	e.pending = false
+	if written {
+		e.lastEmit = now
+	}
+}
+
+// holdOpen watches the endpoints and re-emits the output whenever the endpoints change, as
+// scheduled by -debounce and -write-debounce, running the -on-change command only when the
+// rendered output differs from the last one. It returns once the context is done and the last
+// emit finished, so that the publishers can be closed.
+func holdOpen(ctx context.Context, clientset *kubernetes.Clientset, discoverer *discovery.Discoverer, s *settings, last *discovery.Result, output string) {
+	if s.onChange != nil {
+		go s.onChange.run(ctx)
+	}
+	changes := make(chan *discovery.Result, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lastSum := sha256.Sum256([]byte(output))
+		schedule := &emitSchedule{debounce: *debounce, interval: *writeDebounce, lastEmit: time.Now()}
+		var pending *discovery.Result
+		var timer <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case pending = <-changes:
+				timer = time.After(schedule.change(time.Now()))
+			case <-timer:
+				current := pending
+				pending, timer = nil, nil
+				if endpointsKey(current.Endpoints) == endpointsKey(last.Endpoints) {
+					schedule.done(time.Now(), false)
+					continue
+				}
+				log.Infof("Endpoints changed = %s", discovery.Names(current.Endpoints))
+				output, emitted := emit(ctx, clientset, discoverer, current, s)
+				schedule.done(time.Now(), true)
+				last = current
+				if sum := sha256.Sum256([]byte(output)); sum != lastSum {
+					lastSum = sum
+					if s.onChange != nil {
+						s.onChange.notify(output, emitted)
+					}
+				} else {
+					log.Debug("Rendered output unchanged")
+				}
+			}
+		}
+	}()
+	discoverer.Watch(ctx, s.options, func(current *discovery.Result) {
+		// only the latest change is emitted
+		select {
+		case <-changes:
+		default:
+		}
+		changes <- current
+	})
+	<-done
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// simulate delivers the changes at the offsets to the schedule, polling it every 100ms as the
+// holdOpen timer would fire, and returns the offsets of the emits with the change they emitted
+func simulate(schedule *emitSchedule, changes []time.Duration, until time.Duration) (emits []time.Duration, emitted []int) {
+	start := time.Unix(0, 0)
+	schedule.lastEmit = start
+	var due time.Time
+	latest, next := -1, 0
+	for offset := time.Duration(0); offset <= until; offset += 100 * time.Millisecond {
+		now := start.Add(offset)
+		for next < len(changes) && changes[next] <= offset {
+			due = now.Add(schedule.change(now))
+			latest = next
+			next++
+		}
+		if schedule.pending && !now.Before(due) {
+			schedule.done(now, true)
+			emits, emitted = append(emits, offset), append(emitted, latest)
+		}
+	}
+	return emits, emitted
+}
+
+// flapping changes the endpoints every 500ms for 10s
+func flapping() []time.Duration {
+	changes := []time.Duration{}
+	for offset := 500 * time.Millisecond; offset <= 10*time.Second; offset += 500 * time.Millisecond {
+		changes = append(changes, offset)
+	}
+	return changes
+}
+
+func TestEmitScheduleRateLimit(t *testing.T) {
+	changes := flapping()
+	emits, emitted := simulate(&emitSchedule{interval: 3 * time.Second}, changes, time.Minute)
+	for i := 1; i < len(emits); i++ {
+		if gap := emits[i] - emits[i-1]; gap < 3*time.Second {
+			t.Errorf("emits %v are %v apart, want at most one every 3s", emits, gap)
+		}
+	}
+	// the first change after the start is held until the interval is over, then every 3s
+	if len(emits) != 4 {
+		t.Errorf("emits = %v, want 4 of them", emits)
+	}
+	if last := emitted[len(emitted)-1]; last != len(changes)-1 {
+		t.Errorf("the last emit is of change %d, want the final change %d", last, len(changes)-1)
+	}
+}
+
+func TestEmitScheduleDebounceMaxWait(t *testing.T) {
+	changes := flapping()
+	// the plain debounce only emits once the flapping settles
+	emits, _ := simulate(&emitSchedule{debounce: time.Second}, changes, time.Minute)
+	if want := []time.Duration{11 * time.Second}; len(emits) != 1 || emits[0] != want[0] {
+		t.Errorf("debounce emits = %v, want %v", emits, want)
+	}
+	// with an interval they're emitted during the flapping too
+	emits, emitted := simulate(&emitSchedule{debounce: time.Second, interval: 4 * time.Second}, changes, time.Minute)
+	if len(emits) < 3 {
+		t.Errorf("debounce with an interval emits = %v, want some during the flapping", emits)
+	}
+	if last := emitted[len(emitted)-1]; last != len(changes)-1 || emits[len(emits)-1] < 11*time.Second {
+		t.Errorf("the last emit is of change %d at %v, want the final change once settled", last, emits[len(emits)-1])
+	}
+}
+
+func TestEmitScheduleQuiet(t *testing.T) {
+	// a change long after the last emit is emitted right away
+	emits, _ := simulate(&emitSchedule{interval: 3 * time.Second}, []time.Duration{10 * time.Second}, time.Minute)
+	if len(emits) != 1 || emits[0] != 10*time.Second {
+		t.Errorf("emits = %v, want one at 10s", emits)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// hookChange is an endpoint change to run the hook for
+type hookChange struct {
+	output string
+	hosts  []string
+}
+
+// changeHook runs a shell command when the endpoints change, once they stayed unchanged for the
+// debounce delay and no sooner than minInterval after the previous run
+type changeHook struct {
+	command     string
+	debounce    time.Duration
+	minInterval time.Duration
+	changes     chan hookChange
+}
+
+// newChangeHook creates the hook, started by run
+func newChangeHook(command string, debounce time.Duration, minInterval time.Duration) *changeHook {
+	if debounce < 0 || minInterval < 0 {
+		log.Fatalf("-on-change-debounce and -on-change-min-interval can't be negative")
+	}
+	return &changeHook{command: command, debounce: debounce, minInterval: minInterval, changes: make(chan hookChange, 1)}
+}
+
+// notify queues a change, replacing the one not run yet
+func (h *changeHook) notify(output string, hosts []string) {
+	select {
+	case <-h.changes:
+	default:
+	}
+	h.changes <- hookChange{output: output, hosts: hosts}
+}
+
+// run executes the command for the queued changes until the context is done
+func (h *changeHook) run(ctx context.Context) {
+	var pending *hookChange
+	var lastRun time.Time
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-h.changes:
+			pending = &change
+			delay := h.debounce
+			if wait := h.minInterval - time.Since(lastRun); wait > delay {
+				delay = wait
+			}
+			timer = time.After(delay)
+		case <-timer:
+			h.execute(ctx, *pending)
+			lastRun = time.Now()
+			pending, timer = nil, nil
+		}
+	}
+}
+
+// execute runs the command through the shell with the endpoints in ENDPOINTS and ENDPOINT_COUNT
+// and the rendered output on stdin
+func (h *changeHook) execute(ctx context.Context, change hookChange) {
+	cmd := shellCommand(ctx, h.command)
+	cmd.Env = append(os.Environ(),
+		"ENDPOINTS="+strings.Join(change.hosts, ","),
+		"ENDPOINT_COUNT="+strconv.Itoa(len(change.hosts)))
+	cmd.Stdin = strings.NewReader(change.output)
+	// keep stdout for the emitted output
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	log.Infof("Running the -on-change command for %d endpoints", len(change.hosts))
+	if err := cmd.Run(); err != nil {
+		log.Errorf("The -on-change command failed: %v", err)
+	}
+}
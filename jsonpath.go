@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// parseJSONPath validates a kubectl-style JSONPath expression such as {.subsets[*].addresses[*].ip}
+func parseJSONPath(expr string) *jsonpath.JSONPath {
+	j := jsonpath.New("endpoints")
+	j.AllowMissingKeys(true)
+	if err := j.Parse(expr); err != nil {
+		log.Fatalf("Invalid -jsonpath %q: %v", expr, err)
+	}
+	return j
+}
+
+// formatJSONPath evaluates the expression against each fetched endpoints object, one result per line
+func formatJSONPath(j *jsonpath.JSONPath, objects []*core.Endpoints) string {
+	var b bytes.Buffer
+	for _, endpoints := range objects {
+		// evaluate against the JSON form so that field names match the API like in kubectl
+		data, err := json.Marshal(endpoints)
+		if err != nil {
+			log.Fatalf("Unable to encode endpoints %s: %v", endpoints.Name, err)
+		}
+		var object interface{}
+		if err := json.Unmarshal(data, &object); err != nil {
+			log.Fatalf("Unable to decode endpoints %s: %v", endpoints.Name, err)
+		}
+		if err := j.Execute(&b, object); err != nil {
+			log.Errorf("Unable to evaluate -jsonpath on endpoints %s: %v", endpoints.Name, err)
+			continue
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -7,136 +7,529 @@ Kubernetes service endpoint discovery
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/golang/glog"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
 	core "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func homeDir() string {
-	if h := os.Getenv("HOME"); h != "" {
-		return h
+// getServiceNames returns the names of the services whose endpoints objects were read
+func getServiceNames(result *discovery.Result) []string {
+	names := []string{}
+	for _, object := range result.Objects {
+		names = append(names, object.Name)
 	}
-	return os.Getenv("USERPROFILE") // windows
+	return names
 }
 
-// getHostnames extracts hostnames from the endpoint subset
-func getHostnames(subsets []core.EndpointSubset) []string {
-	hostnames := []string{}
-	for _, ss := range subsets {
-		for _, dns := range ss.Addresses {
-			hostnames = append(hostnames, dns.Hostname)
-		}
+// formatOutput parepares an output in the appropriate format, falling back to the
+// default format when the service name isn't a registered format
+func formatOutput(result *discovery.Result, options format.Options, name string) (string, error) {
+	formatter, err := format.Lookup(name)
+	if err != nil {
+		formatter, _ = format.Lookup("default")
 	}
-	return hostnames
+	return formatter(result.Endpoints, options)
 }
 
-// getFqdn constructs FQDN names for array items
-func getFqdn(hostnames []string, namespaceName string, serviceName string, domainName string) []string {
-	fqdns := []string{}
-	for _, hostname := range hostnames {
-		fqdns = append(fqdns, hostname+"."+serviceName+"."+namespaceName+"."+"svc"+"."+domainName)
+// emit prints the hosts in the configured format and writes the structured result when requested,
+// returning the rendered output and the emitted hosts
+func emit(ctx context.Context, clientset *kubernetes.Clientset, discoverer *discovery.Discoverer, result *discovery.Result, s *settings) (string, []string) {
+	if s.cacheFile != nil {
+		s.cacheFile.save(result, s.options.Count)
+	}
+	if s.readiness != nil && clientset != nil {
+		s.readiness.update(ctx, clientset, result)
+	}
+	if s.excludeSelf {
+		// the count was checked against every member, the local pod included
+		result = withoutSelf(result, s.selfHostname, s.formatOptions.SelfIP)
+	}
+	if *skipFlag > 0 || *limitFlag > 0 {
+		result = selectEndpoints(result, *skipFlag, *limitFlag)
+	}
+	if s.picker != nil {
+		result = s.picker.pick(result)
+	}
+	hosts := discovery.Names(result.Endpoints)
+	if s.validateDNS != "" {
+		if mismatches := validateNames(result.Endpoints); mismatches > 0 && s.validateDNS == "strict" {
+			log.Fatalf("DNS validation failed for %d of %d endpoints", mismatches, len(result.Endpoints))
+		}
+	}
+	var output string
+	var err error
+	options := s.formatOptions
+	options.Zone = func(endpoint discovery.Endpoint) string {
+		return discoverer.EndpointZone(ctx, endpoint)
+	}
+	if s.jsonPath != nil {
+		output = formatJSONPath(s.jsonPath, result.Objects)
+	} else {
+		if s.template != nil {
+			output, err = s.template(result.Endpoints, options)
+		} else if s.command != nil {
+			output, err = s.command(result.Endpoints, options)
+		} else if s.format != "" {
+			output, err = formatOutput(result, options, s.format)
+		} else {
+			output, err = formatOutput(result, options, s.options.Service)
+		}
+		if err != nil {
+			log.Fatalf("Unable to render the output: %v", err)
+		}
+	}
+	if s.membership != nil {
+		s.membership.print(result.Endpoints, options)
+	} else if s.output == nil && !*execMode {
+		fmt.Print(output)
+	}
+	var advice *quorumAdvice
+	if *quorumAdviceFlag {
+		advice = getQuorumAdvice(len(hosts), s.options.Count)
+		logQuorumAdvice(advice, s.options.Count)
+	}
+	partial := isPartial(result, s.options.Count)
+	// the outputs shared by the replicas, only written by the leader with -leader-election-lease
+	publish := func() {
+		if s.mirrorTo != nil {
+			source := s.options.Namespace + "/" + strings.Join(getServiceNames(result), ",")
+			mirrorEndpoints(ctx, clientset, s.mirrorTo, source, getMirrorSubsets(result, s.options.PortName, s.options.PortNumber))
+		}
+		if s.configMap != nil {
+			s.configMap.publish(ctx, output)
+		}
+		for _, sink := range s.sinks {
+			sink.write(ctx, result.Endpoints, options)
+		}
+		if s.output != nil {
+			s.output.write(output)
+		}
+		if s.outputDir != nil {
+			s.outputDir.write(result.Endpoints, options)
+		}
+		if s.redis != nil {
+			s.redis.publish(output, hosts)
+		}
+		if s.resultFile != nil {
+			writeResult(s.resultFile, result.Endpoints, options, advice, partial)
+		}
+		if s.webhook != nil {
+			s.webhook.publish(encodeResult(result.Endpoints, options, advice, partial))
+		}
+	}
+	if s.leader != nil {
+		s.leader.publish(publish)
+	} else {
+		publish()
 	}
-	return fqdns
+	return output, hosts
+}
+
+// envInt returns the numeric value of the environment variable, 0 when unset or invalid
+func envInt(name string) int {
+	value, _ := strconv.Atoi(os.Getenv(name))
+	return value
 }
 
-// getNodeIndex allows to get a node index for services like zookeeper
-func getNodeIndex(node string) string {
-	re := regexp.MustCompile(`(^\w*)-(\d)`)
-	index, _ := strconv.Atoi(re.FindStringSubmatch(node)[2])
-	index++
-	return strconv.Itoa(index)
+// envDuration returns the duration of the environment variable, 0 when unset or invalid
+func envDuration(name string) time.Duration {
+	value, _ := time.ParseDuration(os.Getenv(name))
+	return value
 }
 
-// formatOutput parepares an output in the appropriate format
-func formatOutput(result []string, format string) {
-	switch format {
-	case "zookeeper":
-		for _, host := range result {
-			fmt.Printf("server.%s=%s:2888:3888;2181\n", getNodeIndex(host), host)
+// firstEnv returns the value of the first of the environment variables that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
 		}
-	case "elasticsearch":
-		fmt.Printf("discovery.zen.ping.unicast.hosts: [%s]\n", strings.Join(result, ", "))
-	default:
-		fmt.Printf(strings.Join(result, ", "))
 	}
+	return ""
 }
 
 func parseConfig() *string {
-	var kubeconfig *string
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+	kubeconfig := flag.String("kubeconfig", "", "(optional) absolute path to the kubeconfig file, the KUBECONFIG files or ~/.kube/config by default")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [serve|check] [flags] [-exec -- command args...]\n\nFlags fall back to the environment variables shown in their description.\n\n", os.Args[0])
+		flag.PrintDefaults()
 	}
 	flag.Parse()
+	if *configFile != "" {
+		applyConfigFile(*configFile)
+	}
 	return kubeconfig
 }
 
-func buildExternalConfig(kubeconfig *string) *rest.Config {
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+// buildConfig uses -server, or the in-cluster configuration when running in a pod without an
+// explicit kubeconfig or context, and otherwise loads the kubeconfig like kubectl does:
+// -kubeconfig, the KUBECONFIG file list or ~/.kube/config, with -context selecting the context.
+// The credential flags apply over any of them.
+func buildConfig(kubeconfig string, context string) *rest.Config {
+	inCluster := os.Getenv("KUBERNETES_SERVICE_HOST") != "" && os.Getenv("KUBERNETES_SERVICE_PORT") != ""
+	inCluster = inCluster && kubeconfig == "" && context == "" && os.Getenv("KUBECONFIG") == ""
+	if config := explicitConfig(inCluster); config != nil {
+		return withClientSettings(withCredentials(config))
+	}
+	if inCluster {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			log.Fatalf("Unable to load the in-cluster configuration: %v", err)
+		}
+		return withClientSettings(withCredentials(config))
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if clientcmd.IsEmptyConfig(err) {
+		log.Fatalf("No Kubernetes configuration: not running in a cluster and no kubeconfig was found. " +
+			"Set -kubeconfig or KUBECONFIG to a kubeconfig file, or -server to the API server.")
+	}
 	if err != nil {
-		panic(err.Error())
+		log.Fatalf("Unable to load the kubeconfig: %v", err)
+	}
+	return withClientSettings(withCredentials(config))
+}
+
+// withClientSettings makes the client negotiate protobuf, smaller and faster to decode than JSON
+// for the built-in types, identifies the tool in its User-Agent, and applies -kube-api-qps and
+// -kube-api-burst
+func withClientSettings(config *rest.Config) *rest.Config {
+	config.UserAgent = userAgent()
+	config.AcceptContentTypes = "application/vnd.kubernetes.protobuf,application/json"
+	config.ContentType = "application/vnd.kubernetes.protobuf"
+	if *kubeAPIQPS > 0 {
+		config.QPS = float32(*kubeAPIQPS)
+	}
+	if *kubeAPIBurst > 0 {
+		config.Burst = *kubeAPIBurst
 	}
 	return config
 }
 
 var err error
 
+var logLevel = flag.String("log-level", firstEnv("ENDPOINT_LOG_LEVEL", "LOG_LEVEL"), "minimum level of the logged messages: debug, info (default), warn or error (env ENDPOINT_LOG_LEVEL)")
+
+var logFormat = flag.String("log-format", os.Getenv("ENDPOINT_LOG_FORMAT"), "format of the log messages written to stderr: text (default) or json (env ENDPOINT_LOG_FORMAT)")
+
+// the logging flags of glog, accepted so that existing command lines keep working
+var _ = flag.Bool("logtostderr", true, "ignored, messages are always logged to stderr")
+var _ = flag.Bool("alsologtostderr", false, "ignored, messages are always logged to stderr")
+
+var kubeContext = flag.String("context", "", "kubeconfig context to use, the current context by default")
+
+var contexts = flag.String("contexts", os.Getenv("ENDPOINT_CONTEXTS"), "comma separated kubeconfig context[=domain] list to aggregate the endpoints of the service from (env ENDPOINT_CONTEXTS)")
+
+var namespaceFlag = flag.String("namespace", os.Getenv("ENDPOINT_NAMESPACE_NAME"), "namespace of the service (env ENDPOINT_NAMESPACE_NAME)")
+
+var serviceFlag = flag.String("service", os.Getenv("ENDPOINT_SERVICE_NAME"), "name of the service to discover, or a comma separated list of [namespace/]service (env ENDPOINT_SERVICE_NAME)")
+
+var serviceSelector = flag.String("service-selector", os.Getenv("ENDPOINT_SERVICE_SELECTOR"), "discover every service matching the label selector instead of -service (env ENDPOINT_SERVICE_SELECTOR)")
+
+var allNamespaces = flag.Bool("all-namespaces", os.Getenv("ENDPOINT_ALL_NAMESPACES") == "true", "match -service-selector or ENDPOINT_SERVICE_REGEX against the services of every namespace, or discover the services named -service in every namespace without them (env ENDPOINT_ALL_NAMESPACES)")
+
+var fromFile = flag.String("from-file", os.Getenv("ENDPOINT_FROM_FILE"), "read the endpoints from a YAML or JSON manifest of Endpoints or EndpointSlices, - for stdin, instead of the cluster (env ENDPOINT_FROM_FILE)")
+
+var backendFlag = flag.String("backend", os.Getenv("ENDPOINT_BACKEND"), "API the endpoints are read from: endpoints (default), endpointslices, auto, or dns to resolve the records of the headless service (env ENDPOINT_BACKEND)")
+
+var dnsTTL = flag.Bool("dns-ttl", os.Getenv("ENDPOINT_DNS_TTL") == "true", "with -backend dns and -watch or -hold, re-resolve the records once their TTL expires instead of every -interval (env ENDPOINT_DNS_TTL)")
+
+var domainFlag = flag.String("domain", os.Getenv("ENDPOINT_DOMAIN_NAME"), "cluster domain the FQDNs are built with (env ENDPOINT_DOMAIN_NAME)")
+
+var minEndpoints = flag.Int("min-endpoints", envInt("MINIMUM_MASTER_NODES"), "number of endpoints to wait for (env MINIMUM_MASTER_NODES)")
+
+var portNameFlag = flag.String("port-name", os.Getenv("ENDPOINT_PORT_NAME"), "keep only the endpoints exposing the named port and use it as their port (env ENDPOINT_PORT_NAME)")
+
+var addressFamily = flag.String("address-family", os.Getenv("ENDPOINT_ADDRESS_FAMILY"), "keep only the ipv4 or ipv6 addresses of dual-stack services, or both with dual, the default (env ENDPOINT_ADDRESS_FAMILY)")
+
+var addressType = flag.String("address-type", os.Getenv("ENDPOINT_ADDRESS_TYPE"), "emit the endpoint hostname FQDNs, their IPs, or auto to use the IP of addresses without a hostname (env ENDPOINT_ADDRESS_TYPE)")
+var hostnameSource = flag.String("hostname-source", os.Getenv("ENDPOINT_HOSTNAME_SOURCE"), "comma-separated fallback chain naming the addresses without a hostname: hostname, pod (the target pod name), dns (the reverse DNS name of the IP) and ip, hostname,pod,dns,ip by default (env ENDPOINT_HOSTNAME_SOURCE)")
+
+var includeNotReady = flag.Bool("include-not-ready", os.Getenv("ENDPOINT_INCLUDE_NOT_READY") == "true", "also discover the not-ready addresses, for clusters whose pods only become ready once formed (env ENDPOINT_INCLUDE_NOT_READY)")
+
+var zoneFlag = flag.String("zone", os.Getenv("ENDPOINT_ZONE"), "keep only the endpoints on nodes of the availability zone, or of the zone of the NODE_NAME node with auto (env ENDPOINT_ZONE)")
+
+var readySuffix = flag.String("ready-suffix", os.Getenv("ENDPOINT_READY_SUFFIX"), "with -include-not-ready, appended to the ready names of the default format and set as .Readiness in templates, e.g. ' (ready)' (env ENDPOINT_READY_SUFFIX)")
+
+var notReadySuffix = flag.String("not-ready-suffix", os.Getenv("ENDPOINT_NOT_READY_SUFFIX"), "with -include-not-ready, appended to the not-ready names of the default format and set as .Readiness in templates, e.g. ' (not-ready)' (env ENDPOINT_NOT_READY_SUFFIX)")
+
+var loadBalancer = flag.Bool("load-balancer", os.Getenv("ENDPOINT_LOAD_BALANCER") == "true", "emit the load balancer ingress IPs or hostnames of the services instead of their endpoints (env ENDPOINT_LOAD_BALANCER)")
+
+var podSelector = flag.String("pod-selector", os.Getenv("ENDPOINT_POD_SELECTOR"), "discover the pods matching the label selector, e.g. app=kafka, instead of the endpoints of the service, using their IPs unless -address-type is set (env ENDPOINT_POD_SELECTOR)")
+
+var nodeSelector = flag.String("node-selector", os.Getenv("ENDPOINT_NODE_SELECTOR"), "keep only the endpoints on nodes matching the label selector, e.g. topology.kubernetes.io/region=eu-west-1 (env ENDPOINT_NODE_SELECTOR)")
+
+var excludeSelf = flag.Bool("exclude-self", os.Getenv("ENDPOINT_EXCLUDE_SELF") == "true", "leave the local pod, matched by HOSTNAME or POD_IP, out of the output (env ENDPOINT_EXCLUDE_SELF)")
+
+var limitFlag = flag.Int("limit", envInt("ENDPOINT_LIMIT"), "emit at most this many endpoints, in the -sort order, 0 for all of them (env ENDPOINT_LIMIT)")
+
+var pickFlag = flag.String("pick", os.Getenv("ENDPOINT_PICK"), "emit a single endpoint: first in the -sort order, random, or lowest-ordinal (env ENDPOINT_PICK)")
+
+var skipFlag = flag.Int("skip", envInt("ENDPOINT_SKIP"), "leave the first endpoints, in the -sort order, out of the output (env ENDPOINT_SKIP)")
+
+var probePort = flag.String("probe-port", os.Getenv("ENDPOINT_PROBE_PORT"), "only count the endpoints accepting TCP connections on the port (env ENDPOINT_PROBE_PORT)")
+
+var probeTimeout = flag.Duration("probe-timeout", 2*time.Second, "timeout of each -probe-port connection attempt")
+
+var waitFor = flag.String("wait-for", os.Getenv("ENDPOINT_WAIT_FOR"), "wait condition instead of -min-endpoints: >=N or ==N endpoints, all the replicas of the StatefulSet governing the service or of statefulset/<name>, or a quorum of them (env ENDPOINT_WAIT_FOR)")
+
+var sortFlag = flag.String("sort", os.Getenv("ENDPOINT_SORT"), "order of the endpoints: ordinal (default), hostname, ip, none for the API order, weight or first-seen (env ENDPOINT_SORT)")
+
+var formatFlag = flag.String("format", firstEnv("ENDPOINT_FORMAT", "OUTPUT_FORMAT"), "output format, or exec:<command> to render the JSON endpoints with an external command, defaults to the format named like the service (env ENDPOINT_FORMAT or OUTPUT_FORMAT)")
+
+var timeout = flag.Duration("timeout", 5*time.Minute, "how long to wait for the endpoints, shared with the dependency wait")
+
+var interval = flag.Duration("interval", 2*time.Second, "delay before the second poll of the endpoints, doubled after every poll up to -max-interval")
+
+var maxInterval = flag.Duration("max-interval", 30*time.Second, "maximum delay between two polls of the endpoints")
+
+var kubeAPIQPS = flag.Float64("kube-api-qps", 0, "queries per second to the API server, the client-go default of 5 when 0")
+
+var kubeAPIBurst = flag.Int("kube-api-burst", 0, "burst of queries to the API server, the client-go default of 10 when 0")
+
+var allowPartial = flag.Bool("allow-partial", false, "emit the endpoints found when the timeout expires instead of exiting with an error")
+var minRatio = flag.String("min-ratio", os.Getenv("ENDPOINT_MIN_RATIO"), "when -timeout expires, emit the endpoints found if they are at least the fraction of the expected count, e.g. 0.66, as a partial result (env ENDPOINT_MIN_RATIO)")
+
+var stats = flag.Bool("stats", false, "print a summary of the endpoints object composition to stderr on each poll")
+
+var quorumAdviceFlag = flag.Bool("quorum-advice", false, "log the recommended quorum size for the discovered member count")
+
+var jsonPathExpr = flag.String("jsonpath", "", "print the result of a JSONPath expression over the endpoints object instead of the built-in formats")
+
+var templateText = flag.String("template", "", "render the endpoints with a Go text/template instead of the built-in formats")
+
+var outputPath = flag.String("output-file", "", "write the output atomically to the file instead of stdout")
+
+var writeIfChanged = flag.Bool("write-if-changed", os.Getenv("ENDPOINT_WRITE_IF_CHANGED") == "true", "compare every output with the contents of its file and skip the write when they're the same but for the generation timestamp (env ENDPOINT_WRITE_IF_CHANGED)")
+
+var outputCompress = flag.String("output-compress", os.Getenv("ENDPOINT_OUTPUT_COMPRESS"), "gzip to compress the output written to the files and ConfigMaps, never to stdout (env ENDPOINT_OUTPUT_COMPRESS)")
+
+var outputSinks = flag.String("output", os.Getenv("ENDPOINT_OUTPUTS"), "additional outputs as comma-separated <format>=<destination>, the format being a format name, template:<file> or exec:<command> and the destination - for stdout, configmap:namespace/name[:key] or a file, and semicolon-separated port=<name>,format=<format>,file=<path> or configmap=<target> outputs of the endpoints exposing the port (env ENDPOINT_OUTPUTS)")
+
+var reloadSignal = flag.String("reload-signal", "HUP", "signal sent to the reload process when the output file changes")
+
+var reloadPid = flag.Int("reload-pid", 0, "pid of the process to signal when the output file changes")
+
+var reloadPidFile = flag.String("reload-pidfile", "", "file holding the pid of the process to signal when the output file changes")
+
+var execMode = flag.Bool("exec", false, "after discovery, exec the command given after the flags with the endpoints in -exec-env and substituted for {{endpoints}} in its arguments")
+
+var execEnv = flag.String("exec-env", "ENDPOINTS", "environment variable the endpoints are passed to the -exec command in")
+
+var myIDFile = flag.String("zookeeper-myid-file", os.Getenv("ENDPOINT_ZOOKEEPER_MYID_FILE"), "write the ZooKeeper myid of the local pod, derived from its ordinal, to the file (env ENDPOINT_ZOOKEEPER_MYID_FILE)")
+
+var ordinalRegex = flag.String("ordinal-regex", os.Getenv("ENDPOINT_ORDINAL_REGEX"), "regex whose first group extracts the ordinal from the hostnames, the StatefulSet ordinal by default (env ENDPOINT_ORDINAL_REGEX)")
+
+var indexOffset = flag.Int("index-offset", envInt("ENDPOINT_INDEX_OFFSET"), "offset added to the ordinals in the node ids (env ENDPOINT_INDEX_OFFSET)")
+
+var metricsAddress = flag.String("metrics-address", os.Getenv("ENDPOINT_METRICS_ADDRESS"), "address to serve /metrics, /healthz and /readyz on, e.g. :9090 (env ENDPOINT_METRICS_ADDRESS)")
+
+var watchMode = flag.Bool("watch", false, "emit the endpoints immediately and re-emit them on every change without waiting for a count")
+
+var cacheFile = flag.String("cache-file", os.Getenv("ENDPOINT_CACHE_FILE"), "file keeping the endpoints of the last successful discovery, emitted when the API server is unreachable or the discovery times out (env ENDPOINT_CACHE_FILE)")
+
+var maxCacheAge = flag.Duration("max-cache-age", 0, "oldest -cache-file to fall back to, 0 accepting any age")
+
+var debounce = flag.Duration("debounce", 0, "with -watch or -hold, re-emit the endpoints once they stayed unchanged for this long, coalescing the changes of a rolling update")
+
+var writeDebounce = flag.Duration("write-debounce", envDuration("ENDPOINT_WRITE_DEBOUNCE"), "with -watch or -hold, re-emit the endpoints at most once per interval however often they change, the latest change always being emitted (env ENDPOINT_WRITE_DEBOUNCE)")
+
+var onChange = flag.String("on-change", os.Getenv("ENDPOINT_ON_CHANGE"), "with -watch or -hold, shell command run on every change with the endpoints in ENDPOINTS and the output on stdin (env ENDPOINT_ON_CHANGE)")
+
+var onChangeDebounce = flag.Duration("on-change-debounce", 0, "run the -on-change command once the endpoints stayed unchanged for this long")
+
+var onChangeMinInterval = flag.Duration("on-change-min-interval", 0, "minimum delay between two runs of the -on-change command")
+
+var publishConfigMap = flag.String("publish-configmap", os.Getenv("ENDPOINT_PUBLISH_CONFIGMAP"), "write the output to the namespace/name[:key] ConfigMap, key endpoints by default (env ENDPOINT_PUBLISH_CONFIGMAP)")
+
+var publishLeaderElection = flag.Bool("publish-leader-election", os.Getenv("ENDPOINT_PUBLISH_LEADER_ELECTION") == "true", "with -hold or -watch, only the replica elected on the <name>-leader Lease next to the -publish-configmap ConfigMap writes the shared outputs, an alias of -leader-election-lease (env ENDPOINT_PUBLISH_LEADER_ELECTION)")
+
+var webhookURL = flag.String("webhook-url", os.Getenv("ENDPOINT_WEBHOOK_URL"), "POST every result as JSON to the URL, signed with the ENDPOINT_WEBHOOK_SECRET HMAC key when set (env ENDPOINT_WEBHOOK_URL)")
+
+var hold = flag.Bool("hold", false, "keep watching the endpoints after discovery and re-emit the output on changes until SIGTERM")
+
 func main() {
-	var endpoints *core.Endpoints
-	var config *rest.Config
-	hosts := []string{}
-	namespaceName := os.Getenv("ENDPOINT_NAMESPACE_NAME")
-	serviceName := os.Getenv("ENDPOINT_SERVICE_NAME")
-	domainName := os.Getenv("ENDPOINT_DOMAIN_NAME")
-	kubernetesServiceHost := os.Getenv("KUBERNETES_SERVICE_HOST")
-	kubernetesServicePort := os.Getenv("KUBERNETES_SERVICE_PORT")
+	var result *discovery.Result
+	command := parseCommand()
 	kubeconfigPath := parseConfig()
-
-	//check if the app is running inside the kubernetes cluster
-	if (kubernetesServiceHost != "") && (kubernetesServicePort != "") {
-		config, err = rest.InClusterConfig()
-		if err != nil {
-			panic(err.Error())
-		}
-	} else {
-		if _, err := os.Stat(*kubeconfigPath); err == nil {
-			config = buildExternalConfig(kubeconfigPath)
+	if *showVersion {
+		printVersion()
+		return
+	}
+	if err := log.Setup(os.Stderr, *logLevel, *logFormat); err != nil {
+		log.Fatalf("%v", err)
+	}
+	s := loadSettings()
+	if command == zookeeperBootstrapCommand && (*zookeeperDir == "" || *hold || *watchMode) {
+		log.Fatalf("The %s subcommand requires -zookeeper-dir and can't be combined with -hold or -watch", command)
+	}
+	if *validateTemplate && *fromFile == "" {
+		renderTemplateAndExit(s, format.SampleEndpoints())
+	}
+	if *fromFile != "" {
+		if command != "" {
+			log.Fatalf("-from-file can't be combined with the %s subcommand", command)
 		}
+		emitFixture(*fromFile, s)
+		return
+	}
+	if len(s.contexts) > 0 {
+		// the first cluster serves the events, mirror and StatefulSet lookups
+		*kubeContext = s.contexts[0].name
+	}
+	config := buildConfig(*kubeconfigPath, *kubeContext)
+
+	if *myIDFile != "" {
+		writeMyID(*myIDFile, s.formatOptions)
 	}
 
 	// create the clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		panic(err.Error())
+		log.Fatalf("Unable to create the Kubernetes client: %v", err)
+	}
+	// cancelled on SIGTERM and SIGINT, so that a terminating pod stops waiting right away
+	ctx, cancel := withTermination(context.Background())
+	defer cancel()
+	s.options.Backend = discovery.ResolveBackend(clientset, s.options.Backend)
+	if *readAnnotations {
+		applyServiceAnnotations(ctx, clientset, s)
+	}
+	if command == checkCommand {
+		checkPermissions(ctx, clientset, s)
+		return
+	}
+	if s.domainAuto {
+		s.options.Domain = discovery.DiscoverDomain(ctx, clientset, s.options.Domain)
+	}
+	discoverer := discovery.NewDiscoverer(clientset)
+	if s.options.Zone == "auto" {
+		nodeName := os.Getenv("NODE_NAME")
+		if nodeName == "" {
+			log.Fatalf("-zone auto requires NODE_NAME to be set to the node of the pod")
+		}
+		if s.options.Zone = discoverer.Zone(ctx, nodeName); s.options.Zone == "unknown" {
+			log.Fatalf("Unable to find the availability zone of node %s", nodeName)
+		}
+		log.Infof("Keeping the endpoints in zone %s", s.options.Zone)
+	}
+	if s.waitFor != nil && s.waitFor.statefulSet != "" {
+		s.waitFor.resolve(ctx, discoverer, &s.options)
+	}
+	var events *eventNotifier
+	if s.emitEvents {
+		events = newEventNotifier(ctx, clientset, s.options.Namespace, s.options.Service)
 	}
 
-	//Wait for some endpoints.
-	count, _ := strconv.Atoi(os.Getenv("MINIMUM_MASTER_NODES"))
-	for t := time.Now(); time.Since(t) < 5*time.Minute; time.Sleep(10 * time.Second) {
-		endpoints, err = clientset.Core().Endpoints(namespaceName).Get(serviceName, metav1.GetOptions{})
-		if err != nil {
-			continue
+	if s.configMap != nil {
+		s.configMap.start(clientset)
+	}
+	startOutputSinks(clientset, s.sinks)
+	if s.leader != nil {
+		s.leader.start(ctx, clientset)
+	}
+	if command == serveCommand {
+		serveEndpoints(ctx, discoverer, s)
+		return
+	}
+	// the dependency and the primary service share the discovery timeout
+	waitCtx, waitCancel := context.WithTimeout(ctx, s.options.Timeout)
+	defer waitCancel()
+	if s.dependency != nil {
+		waitForDependency(waitCtx, discoverer, s)
+	}
+	var cached *discovery.Result
+	if s.cacheFile != nil {
+		// don't wait for the timeout when the API server can't be reached at all
+		if first := discoverer.Poll(ctx, s.options); isUnreachable(first.Err) {
+			log.Warningf("Unable to reach the API server: %v", first.Err)
+			cached = s.cacheFile.load(ctx, s.options)
+		}
+	}
+	if cached == nil && (*watchMode || *hold) && s.options.Backend != discovery.BackendDNS && !s.options.LoadBalancer {
+		// the long-running modes read the endpoints from a local cache instead of polling the API
+		if err := discoverer.StartCache(ctx, s.options); err != nil {
+			log.Fatalf("Unable to watch the endpoints: %v", err)
+		}
+	}
+
+	if cached != nil {
+		// holdOpen watches the API again and re-emits the endpoints once it's reachable
+		result = cached
+	} else if *watchMode {
+		// emit the current endpoints right away, holdOpen re-emits them on every change
+		result = discoverer.Poll(ctx, s.options)
+	} else {
+		if events != nil {
+			events.record(core.EventTypeNormal, "WaitingForEndpoints", "Waiting for %d endpoints", s.options.Count)
 		}
-		hosts = getFqdn(getHostnames(endpoints.Subsets), namespaceName, serviceName, domainName)
-		glog.Infof("Found %s", hosts)
-		if len(hosts) > 0 && len(hosts) == count {
-			break
+		if len(s.contexts) > 0 {
+			result, err = discovery.WaitClusters(waitCtx, buildClusters(*kubeconfigPath, s.contexts), s.options)
+		} else {
+			result, err = discoverer.Wait(waitCtx, s.options)
 		}
+		if events != nil {
+			if err == nil {
+				events.record(core.EventTypeNormal, "EndpointsDiscovered", "Discovered %d endpoints", len(result.Endpoints))
+			} else {
+				events.record(core.EventTypeWarning, "DiscoveryTimeout", "Timed out with %d of %d endpoints", len(result.Endpoints), s.options.Count)
+			}
+			events.close()
+		}
+		if err == context.Canceled {
+			log.Fatalf("Discovery cancelled with %d of %d endpoints", len(result.Endpoints), s.options.Count)
+		}
+		if err != nil && s.cacheFile != nil {
+			if cached := s.cacheFile.load(ctx, s.options); cached != nil {
+				result, err = cached, nil
+			}
+		}
+		if err != nil && !acceptPartial(result, s) {
+			exitFailed(result, s.options.Count)
+		}
+	}
+	log.Infof("Endpoints = %s", discovery.Names(result.Endpoints))
+	if command == zookeeperBootstrapCommand {
+		bootstrapZookeeper(ctx, discoverer, result, s)
+		return
+	}
+	output, _ := emit(ctx, clientset, discoverer, result, s)
+	if s.metrics != nil {
+		s.metrics.emitted()
+	}
+
+	if *execMode {
+		if s.redis != nil {
+			s.redis.close()
+		}
+		if s.webhook != nil {
+			s.webhook.close()
+		}
+		execCommand(flag.Args(), *execEnv, discovery.Names(result.Endpoints), isPartial(result, s.options.Count))
+	}
+	if *hold || *watchMode {
+		holdOpen(ctx, clientset, discoverer, s, result, output)
+	}
+	if s.leader != nil {
+		s.leader.stop()
+	}
+	if s.redis != nil {
+		s.redis.close()
+	}
+	if s.webhook != nil {
+		s.webhook.close()
 	}
-	glog.Infof("Endpoints = %s", hosts)
-	formatOutput(hosts, serviceName)
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+var leaderElectionLease = flag.String("leader-election-lease", os.Getenv("ENDPOINT_LEADER_ELECTION_LEASE"), "with -hold or -watch, only the replica holding the namespace/name Lease writes the shared outputs: the output file and directory, ConfigMaps, -output sinks, mirrored endpoints, Redis, result file and webhook (env ENDPOINT_LEADER_ELECTION_LEASE)")
+
+// runLeaderElection joins the election of the Lease, the replicas being identified by their
+// hostname, until the context is done. onStartedLeading is called every time the replica is
+// elected and onStoppedLeading when it loses the Lease.
+func runLeaderElection(ctx context.Context, clientset kubernetes.Interface, namespaceName string, name string,
+	onStartedLeading func(context.Context), onStoppedLeading func()) *leaderelection.LeaderElector {
+	identity, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("Unable to get the hostname for the leader election: %v", err)
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: namespaceName, Name: name},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: onStartedLeading,
+			OnStoppedLeading: onStoppedLeading,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Invalid leader election: %v", err)
+	}
+	go func() {
+		// Run returns when the leadership is lost, rejoin the election until the context is done
+		for ctx.Err() == nil {
+			elector.Run(ctx)
+		}
+	}()
+	return elector
+}
+
+// leaderLease holds back the publications of a replica until it's elected, the leader
+// publishing the latest endpoints as soon as it holds the Lease
+type leaderLease struct {
+	namespaceName string
+	name          string
+
+	mu      sync.Mutex
+	elector *leaderelection.LeaderElector
+	pending func()
+	// stopped drops the publications once the publishers are being closed
+	stopped bool
+}
+
+// parseLeaderLease parses a namespace/name reference
+func parseLeaderLease(value string) (*leaderLease, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("must be namespace/name")
+	}
+	return &leaderLease{namespaceName: parts[0], name: parts[1]}, nil
+}
+
+// start joins the election of the Lease
+func (l *leaderLease) start(ctx context.Context, clientset kubernetes.Interface) {
+	l.elector = runLeaderElection(ctx, clientset, l.namespaceName, l.name, func(context.Context) {
+		log.Infof("Elected to publish the endpoints, holding the Lease %s/%s", l.namespaceName, l.name)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.pending != nil && !l.stopped {
+			l.pending()
+		}
+		l.pending = nil
+	}, func() {
+		log.Infof("No longer publishing the endpoints, lost the Lease %s/%s", l.namespaceName, l.name)
+	})
+}
+
+// publish runs the publication when the replica leads, or keeps it, replacing the one kept
+// before, for when it's elected
+func (l *leaderLease) publish(publication func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return
+	}
+	if !l.elector.IsLeader() {
+		l.pending = publication
+		return
+	}
+	l.pending = nil
+	publication()
+}
+
+// stop drops the kept publication and the later ones, so that an election won during the
+// shutdown doesn't publish to the closed publishers
+func (l *leaderLease) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped, l.pending = true, nil
+}
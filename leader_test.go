@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// waitLeading waits for the replica to be elected
+func waitLeading(t *testing.T, l *leaderLease) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !l.elector.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatal("not elected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLeaderLeaseStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := parseLeaderLease("default/publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := make(chan string, 2)
+	// kept while another replica leads, then the shutdown begins before this one is elected
+	l.pending = func() { published <- "pending" }
+	l.stop()
+	l.start(ctx, fake.NewSimpleClientset())
+	waitLeading(t, l)
+	l.publish(func() { published <- "after stop" })
+	select {
+	case publication := <-published:
+		t.Errorf("published %s after stop", publication)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLeaderLeaseSingleElection(t *testing.T) {
+	configMap, err := parseConfigMapTarget("default/zk-peers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &settings{configMap: configMap, sinks: parseOutputSinks("hosts=configmap:default/zk-hosts")}
+	if l, _ := s.leaderLease("", true); l == nil || l.namespaceName != "default" || l.name != "zk-peers-leader" {
+		t.Errorf("leaderLease of -publish-leader-election = %+v, want default/zk-peers-leader", l)
+	}
+	// with both flags the ConfigMaps are written by the holder of the -leader-election-lease one
+	l, err := s.leaderLease("default/publisher", true)
+	if err != nil || l == nil || l.name != "publisher" {
+		t.Fatalf("leaderLease of both flags = %+v, %v, want default/publisher", l, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientset := fake.NewSimpleClientset()
+	configMap.start(clientset)
+	startOutputSinks(clientset, s.sinks)
+	l.start(ctx, clientset)
+	waitLeading(t, l)
+	l.publish(func() {
+		configMap.publish(ctx, "zk-0")
+		s.sinks[0].write(ctx, format.SampleEndpoints(), format.Options{})
+	})
+	for _, name := range []string{"zk-peers", "zk-hosts"} {
+		if _, err := clientset.CoreV1().ConfigMaps("default").Get(ctx, name, metav1.GetOptions{}); err != nil {
+			t.Errorf("ConfigMap %s not written by the leader: %v", name, err)
+		}
+	}
+	leases, err := clientset.CoordinationV1().Leases("default").List(ctx, metav1.ListOptions{})
+	if err != nil || len(leases.Items) != 1 {
+		t.Errorf("Leases = %v, %v, want the publisher one only", leases, err)
+	}
+}
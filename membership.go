@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+var watchEvents = flag.Bool("watch-events", os.Getenv("ENDPOINT_WATCH_EVENTS") == "true", "with -watch or -hold, print a JSON line per added, removed or updated endpoint on every change instead of the output (env ENDPOINT_WATCH_EVENTS)")
+
+// The types of the membership events
+const (
+	endpointAdded   = "added"
+	endpointRemoved = "removed"
+	endpointUpdated = "updated"
+)
+
+// membershipEvent is a JSON line of -watch-events
+type membershipEvent struct {
+	Time     string                    `json:"time"`
+	Type     string                    `json:"type"`
+	Endpoint format.StructuredEndpoint `json:"endpoint"`
+}
+
+// membershipTracker prints the changes of the endpoints since the previous emit, every endpoint
+// being added on the first one
+type membershipTracker struct {
+	last map[string]format.StructuredEndpoint
+}
+
+func newMembershipTracker() *membershipTracker {
+	return &membershipTracker{last: map[string]format.StructuredEndpoint{}}
+}
+
+// endpointKey identifies an endpoint across changes
+func endpointKey(endpoint format.StructuredEndpoint) string {
+	return endpoint.Cluster + "/" + endpoint.Namespace + "/" + endpoint.Service + "/" + endpoint.FQDN
+}
+
+// print prints the events of the endpoints added or updated, in their order, then of the ones
+// removed
+func (t *membershipTracker) print(endpoints []discovery.Endpoint, options format.Options) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	events := []membershipEvent{}
+	current := map[string]format.StructuredEndpoint{}
+	for _, endpoint := range format.StructuredEndpoints(endpoints, options) {
+		key := endpointKey(endpoint)
+		current[key] = endpoint
+		previous, ok := t.last[key]
+		switch {
+		case !ok:
+			events = append(events, membershipEvent{Time: now, Type: endpointAdded, Endpoint: endpoint})
+		case !reflect.DeepEqual(previous, endpoint):
+			events = append(events, membershipEvent{Time: now, Type: endpointUpdated, Endpoint: endpoint})
+		}
+	}
+	removed := []string{}
+	for key := range t.last {
+		if _, ok := current[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		events = append(events, membershipEvent{Time: now, Type: endpointRemoved, Endpoint: t.last[key]})
+	}
+	t.last = current
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Errorf("Unable to encode the membership event: %v", err)
+			continue
+		}
+		fmt.Println(string(data))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// metrics tracks the discovery loop for the /metrics, /healthz and /readyz endpoints
+type metrics struct {
+	mu         sync.Mutex
+	attempts   int
+	apiErrors  int
+	lastChange time.Time
+	endpoints  []string
+	ready      bool
+}
+
+// observe records a poll result
+func (m *metrics) observe(result *discovery.Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts++
+	if result.Err != nil {
+		m.apiErrors++
+	}
+	names := discovery.Names(result.Endpoints)
+	if strings.Join(names, ",") != strings.Join(m.endpoints, ",") || m.lastChange.IsZero() {
+		m.lastChange = time.Now()
+	}
+	m.endpoints = names
+}
+
+// emitted marks the discovery as ready once the output was first emitted
+func (m *metrics) emitted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ready = true
+}
+
+func (m *metrics) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP endpoint_discovery_attempts_total Number of endpoint polls.\n")
+	fmt.Fprintf(w, "# TYPE endpoint_discovery_attempts_total counter\n")
+	fmt.Fprintf(w, "endpoint_discovery_attempts_total %d\n", m.attempts)
+	fmt.Fprintf(w, "# HELP endpoint_discovery_api_errors_total Number of polls that got an API error.\n")
+	fmt.Fprintf(w, "# TYPE endpoint_discovery_api_errors_total counter\n")
+	fmt.Fprintf(w, "endpoint_discovery_api_errors_total %d\n", m.apiErrors)
+	fmt.Fprintf(w, "# HELP endpoint_discovery_last_change_timestamp_seconds Time the endpoints last changed.\n")
+	fmt.Fprintf(w, "# TYPE endpoint_discovery_last_change_timestamp_seconds gauge\n")
+	var lastChange int64
+	if !m.lastChange.IsZero() {
+		lastChange = m.lastChange.Unix()
+	}
+	fmt.Fprintf(w, "endpoint_discovery_last_change_timestamp_seconds %d\n", lastChange)
+	fmt.Fprintf(w, "# HELP endpoint_discovery_endpoints Number of endpoints found by the last poll.\n")
+	fmt.Fprintf(w, "# TYPE endpoint_discovery_endpoints gauge\n")
+	fmt.Fprintf(w, "endpoint_discovery_endpoints %d\n", len(m.endpoints))
+}
+
+func (m *metrics) serveReady(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.ready {
+		http.Error(w, "endpoints not emitted yet", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// serve exposes the metrics and health endpoints on the address in the background
+func (m *metrics) serve(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.serveMetrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", m.serveReady)
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.Fatalf("Unable to serve the metrics on %s: %v", address, err)
+		}
+	}()
+	log.Infof("Serving metrics and health endpoints on %s", address)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// mirrorTarget is the Endpoints object the discovered addresses are copied to
+type mirrorTarget struct {
+	namespaceName string
+	serviceName   string
+}
+
+// parseMirrorTarget parses a namespace/service reference
+func parseMirrorTarget(value string) *mirrorTarget {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		log.Fatalf("Invalid ENDPOINT_MIRROR_TO %q: must be namespace/service", value)
+	}
+	return &mirrorTarget{namespaceName: parts[0], serviceName: parts[1]}
+}
+
+// getMirrorSubsets copies the subsets of the source objects, keeping only the discovered addresses
+func getMirrorSubsets(result *discovery.Result, portName string, portNumber int32) []core.EndpointSubset {
+	ips := map[string]bool{}
+	for _, endpoint := range result.Endpoints {
+		ips[endpoint.IP] = true
+	}
+	subsets := []core.EndpointSubset{}
+	for _, object := range result.Objects {
+		for _, ss := range discovery.FilterSubsets(object.Subsets, portName, portNumber) {
+			addresses := []core.EndpointAddress{}
+			for _, address := range ss.Addresses {
+				if ips[address.IP] {
+					// the target pod lives in the source namespace
+					address.TargetRef = nil
+					addresses = append(addresses, address)
+				}
+			}
+			if len(addresses) > 0 {
+				subsets = append(subsets, core.EndpointSubset{Addresses: addresses, Ports: ss.Ports})
+			}
+		}
+	}
+	return subsets
+}
+
+// mirrorEndpoints creates or updates the target Endpoints object so that it lists the discovered addresses
+func mirrorEndpoints(ctx context.Context, clientset *kubernetes.Clientset, target *mirrorTarget, source string, subsets []core.EndpointSubset) {
+	client := clientset.CoreV1().Endpoints(target.namespaceName)
+	existing, err := client.Get(ctx, target.serviceName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = client.Create(ctx, &core.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        target.serviceName,
+				Namespace:   target.namespaceName,
+				Annotations: map[string]string{"endpoint-discovery.io/mirrored-from": source},
+			},
+			Subsets: subsets,
+		}, metav1.CreateOptions{})
+	case err == nil:
+		if equality.Semantic.DeepEqual(existing.Subsets, subsets) {
+			return
+		}
+		existing.Subsets = subsets
+		_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if errors.IsForbidden(err) {
+		log.Fatalf("Writing endpoints %s/%s is forbidden, grant get, create and update on endpoints in %s: %v",
+			target.namespaceName, target.serviceName, target.namespaceName, err)
+	}
+	if err != nil {
+		log.Errorf("Unable to mirror endpoints to %s/%s: %v", target.namespaceName, target.serviceName, err)
+		return
+	}
+	log.Infof("Mirrored %d subsets to endpoints %s/%s", len(subsets), target.namespaceName, target.serviceName)
+}
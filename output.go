@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// outputFile is a file the rendered output is written to, with an optional process to signal on changes
+type outputFile struct {
+	path    string
+	signal  syscall.Signal
+	pid     int
+	pidFile string
+	// sum is the hash of the contents last written, set once written is
+	sum     [sha256.Size]byte
+	written bool
+	// ifChanged compares every output with the file contents instead of the last write, ignoring
+	// the generation timestamps
+	ifChanged bool
+	// gzip compresses the contents written
+	gzip bool
+}
+
+// generatedAtPattern matches the generation timestamp of the JSON and YAML outputs
+var generatedAtPattern = regexp.MustCompile(`(?m)"generatedAt": *"[^"]*"|^ *generatedAt: .*$`)
+
+// withoutTimestamps blanks the generation timestamps so that outputs differing only by them compare equal
+func withoutTimestamps(data []byte) []byte {
+	return generatedAtPattern.ReplaceAll(data, nil)
+}
+
+// newOutputFile validates the reload settings of the output file
+func newOutputFile(path string, signalName string, pid int, pidFile string) *outputFile {
+	o := &outputFile{path: path, pid: pid, pidFile: pidFile}
+	if pid != 0 && pidFile != "" {
+		log.Fatalf("-reload-pid and -reload-pidfile are mutually exclusive")
+	}
+	if pid == 0 && pidFile == "" {
+		// no process to reload
+		return o
+	}
+	if len(reloadSignals) == 0 {
+		log.Fatalf("-reload-pid and -reload-pidfile aren't supported on this platform")
+	}
+	name := strings.TrimPrefix(strings.ToUpper(signalName), "SIG")
+	if name == "" {
+		name = "HUP"
+	}
+	var ok bool
+	if o.signal, ok = reloadSignals[name]; !ok {
+		log.Fatalf("Invalid -reload-signal %q: must be HUP, USR1, USR2, TERM or INT", signalName)
+	}
+	return o
+}
+
+// write replaces the file contents through a rename so that readers never see a partial file,
+// signalling the reload process when the contents changed. The contents are compared with the
+// hash of the last write, or with the file left by a previous run before the first one. With
+// ifChanged they're compared with the file every time, whoever wrote it, and an unchanged output
+// is logged. The uncompressed output is compared with gzip.
+func (o *outputFile) write(output string) {
+	sum := sha256.Sum256([]byte(output))
+	if o.ifChanged {
+		if current, err := o.read(); err == nil && bytes.Equal(withoutTimestamps(current), withoutTimestamps([]byte(output))) {
+			log.Info("Output unchanged", "path", o.path)
+			o.sum, o.written = sum, true
+			return
+		}
+	} else if o.written {
+		if sum == o.sum {
+			return
+		}
+	} else if current, err := o.read(); err == nil && bytes.Equal(current, []byte(output)) {
+		o.sum, o.written = sum, true
+		return
+	}
+	data := []byte(output)
+	if o.gzip {
+		data = gzipOutput(output)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(o.path), "."+filepath.Base(o.path)+".")
+	if err != nil {
+		log.Errorf("Unable to write %s: %v", o.path, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		log.Errorf("Unable to write %s: %v", o.path, err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		log.Errorf("Unable to write %s: %v", o.path, err)
+		return
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		log.Errorf("Unable to write %s: %v", o.path, err)
+		return
+	}
+	if err := replaceFile(tmp.Name(), o.path); err != nil {
+		log.Errorf("Unable to write %s: %v", o.path, err)
+		return
+	}
+	log.Infof("Wrote %s", o.path)
+	o.sum, o.written = sum, true
+	o.reload()
+}
+
+// read returns the current contents of the file, decompressed with gzip
+func (o *outputFile) read() ([]byte, error) {
+	data, err := ioutil.ReadFile(o.path)
+	if err != nil || !o.gzip {
+		return data, err
+	}
+	return gunzipOutput(data), nil
+}
+
+// reload signals the configured process, reading its pid from the pid file when one is used
+func (o *outputFile) reload() {
+	pid := o.pid
+	if o.pidFile != "" {
+		data, err := ioutil.ReadFile(o.pidFile)
+		if err != nil {
+			log.Errorf("Unable to read %s: %v", o.pidFile, err)
+			return
+		}
+		if pid, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+			log.Errorf("Invalid pid in %s: %v", o.pidFile, err)
+			return
+		}
+	}
+	if pid == 0 {
+		return
+	}
+	if err := signalProcess(pid, o.signal); err != nil {
+		log.Errorf("Unable to signal process %d: %v", pid, err)
+		return
+	}
+	log.Infof("Sent %s to process %d", o.signal, pid)
+}
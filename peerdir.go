@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+var outputDir = flag.String("output-dir", os.Getenv("ENDPOINT_OUTPUT_DIR"), "keep a file per endpoint in the directory, named by its ordinal and holding its host:port, removing the files of the endpoints gone (env ENDPOINT_OUTPUT_DIR)")
+
+// peerDirectory is a directory holding a file per endpoint
+type peerDirectory struct {
+	path  string
+	files map[string]*outputFile
+}
+
+func newPeerDirectory(path string) *peerDirectory {
+	return &peerDirectory{path: path, files: map[string]*outputFile{}}
+}
+
+// write writes the file of every endpoint, named by its ordinal shifted by -index-offset, or by
+// its name without one, and removes the other files of the directory
+func (d *peerDirectory) write(endpoints []discovery.Endpoint, options format.Options) {
+	if err := os.MkdirAll(d.path, 0755); err != nil {
+		log.Errorf("Unable to create %s: %v", d.path, err)
+		return
+	}
+	contents := map[string]string{}
+	for _, endpoint := range endpoints {
+		name := endpoint.FQDN
+		if ordinal := discovery.ParseOrdinal(endpoint.Hostname, options.OrdinalRegex); ordinal >= 0 {
+			name = strconv.Itoa(ordinal + options.IndexOffset)
+		}
+		address := endpoint.FQDN
+		if endpoint.Port != 0 {
+			address = net.JoinHostPort(endpoint.FQDN, strconv.Itoa(int(endpoint.Port)))
+		}
+		contents[name] = address + "\n"
+	}
+	names := []string{}
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file, ok := d.files[name]
+		if !ok {
+			file = &outputFile{path: filepath.Join(d.path, name)}
+			d.files[name] = file
+		}
+		file.write(contents[name])
+	}
+	// the files of the endpoints gone, those left by a previous run included, but not the
+	// temporary files of the writes
+	entries, err := ioutil.ReadDir(d.path)
+	if err != nil {
+		log.Errorf("Unable to read %s: %v", d.path, err)
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := contents[name]; ok || entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(d.path, name)); err != nil {
+			log.Errorf("Unable to remove %s: %v", filepath.Join(d.path, name), err)
+			continue
+		}
+		delete(d.files, name)
+		log.Infof("Removed %s", filepath.Join(d.path, name))
+	}
+}
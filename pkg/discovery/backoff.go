@@ -0,0 +1,35 @@
+package discovery
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff spaces the polls of a wait loop, doubling the delay after every poll up to the maximum.
+// Each delay is randomized by ±20% so that pods started together don't poll in lockstep.
+type backoff struct {
+	next time.Duration
+	max  time.Duration
+	rand *rand.Rand
+}
+
+func newBackoff(opts Options) *backoff {
+	max := opts.MaxInterval
+	if max < waitInterval(opts) {
+		max = waitInterval(opts)
+	}
+	return &backoff{
+		next: waitInterval(opts),
+		max:  max,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// delay returns the time to wait before the next poll
+func (b *backoff) delay() time.Duration {
+	delay := b.next
+	if b.next *= 2; b.next > b.max {
+		b.next = b.max
+	}
+	return time.Duration(float64(delay) * (0.8 + 0.4*b.rand.Float64()))
+}
@@ -0,0 +1,160 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// endpointsCache is an informer cache of the Endpoints, EndpointSlices or selected pods the polls
+// read from, and of the Services when they're found by listing them
+type endpointsCache struct {
+	backend     string
+	endpoints   corelisters.EndpointsLister
+	slices      discoverylisters.EndpointSliceLister
+	pods        corelisters.PodLister
+	podSelector labels.Selector
+	informer    cache.SharedIndexInformer
+	services    corelisters.ServiceLister
+	// serviceInformer is nil unless the services are listed
+	serviceInformer cache.SharedIndexInformer
+}
+
+// StartCache keeps an informer cache of the Endpoints, or EndpointSlices with that backend, of
+// the namespaces of the services, or of the pods matching the pod selector, and of the Services
+// when ListsServices, that the polls and Watch then read instead of the API server until the
+// context is done. It returns once the cache is synced, failing when that takes longer than the
+// wait timeout.
+func (d *Discoverer) StartCache(ctx context.Context, opts Options) error {
+	if opts.Backend == BackendDNS {
+		return fmt.Errorf("the %s backend can't be cached", BackendDNS)
+	}
+	if opts.LoadBalancer {
+		return fmt.Errorf("the load balancers can't be cached")
+	}
+	factoryOptions := []informers.SharedInformerOption{informers.WithNamespace(watchNamespace(opts))}
+	if opts.PodSelector != nil {
+		factoryOptions = append(factoryOptions, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = opts.PodSelector.String()
+		}))
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(d.clientset, 0, factoryOptions...)
+	c := &endpointsCache{backend: opts.Backend, podSelector: opts.PodSelector}
+	if opts.PodSelector != nil {
+		informer := factory.Core().V1().Pods()
+		c.pods, c.informer = informer.Lister(), informer.Informer()
+	} else if opts.Backend == BackendEndpointSlices {
+		informer := factory.Discovery().V1().EndpointSlices()
+		c.slices, c.informer = informer.Lister(), informer.Informer()
+	} else {
+		informer := factory.Core().V1().Endpoints()
+		c.endpoints, c.informer = informer.Lister(), informer.Informer()
+	}
+	synced := []cache.InformerSynced{c.informer.HasSynced}
+	if ListsServices(opts) && opts.PodSelector == nil {
+		informer := factory.Core().V1().Services()
+		c.services, c.serviceInformer = informer.Lister(), informer.Informer()
+		synced = append(synced, c.serviceInformer.HasSynced)
+	}
+	factory.Start(ctx.Done())
+	syncCtx, cancel := context.WithTimeout(ctx, waitTimeout(opts))
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), synced...) {
+		return fmt.Errorf("the endpoints cache didn't sync: %v", syncCtx.Err())
+	}
+	d.cache = c
+	return nil
+}
+
+// get returns the endpoints object of the service from the cache, building it from the
+// EndpointSlices of the service when that backend is used, or from the selected pods. The
+// cached objects are read in place, not copied, and must not be modified.
+func (c *endpointsCache) get(namespaceName string, serviceName string) (*core.Endpoints, error) {
+	if c.pods != nil {
+		pods, err := c.pods.Pods(namespaceName).List(c.podSelector)
+		if err != nil {
+			return nil, err
+		}
+		return podsToEndpoints(namespaceName, serviceName, pods), nil
+	}
+	if c.backend != BackendEndpointSlices {
+		return c.endpoints.Endpoints(namespaceName).Get(serviceName)
+	}
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: serviceName})
+	slices, err := c.slices.EndpointSlices(namespaceName).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	return slicesToEndpoints(namespaceName, serviceName, slices), nil
+}
+
+// matchingServices lists the cached services as getMatchingServices lists them from the API
+func (c *endpointsCache) matchingServices(namespaceName string, opts Options) ([]ServiceRef, error) {
+	selector, err := labels.Parse(opts.ServiceSelector)
+	if err != nil {
+		return nil, err
+	}
+	services, err := c.services.Services(namespaceName).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	refs := []ServiceRef{}
+	for _, service := range services {
+		if opts.ServiceSelector == "" && opts.ServiceRegex == nil && service.Name != opts.Service {
+			continue
+		}
+		if opts.ServiceRegex == nil || opts.ServiceRegex.MatchString(service.Name) {
+			refs = append(refs, ServiceRef{Namespace: service.Namespace, Name: service.Name})
+		}
+	}
+	return refs, nil
+}
+
+// onChange calls fn on every change of the cached objects, the Services being relabeled, created
+// or deleted included
+func (c *endpointsCache) onChange(fn func()) {
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { fn() },
+		UpdateFunc: func(interface{}, interface{}) { fn() },
+		DeleteFunc: func(interface{}) { fn() },
+	}
+	c.informer.AddEventHandler(handler)
+	if c.serviceInformer != nil {
+		c.serviceInformer.AddEventHandler(handler)
+	}
+}
+
+// OnCacheChange calls fn on every change of the objects cached by StartCache, e.g. to push the
+// endpoints to subscribers. It fails when no cache was started.
+func (d *Discoverer) OnCacheChange(fn func()) error {
+	if d.cache == nil {
+		return fmt.Errorf("no endpoints cache was started")
+	}
+	d.cache.onChange(fn)
+	return nil
+}
+
+// watchNamespace returns the namespace of the services, or every namespace when they span several
+func watchNamespace(opts Options) string {
+	if len(opts.Services) > 0 {
+		namespaceName := opts.Services[0].Namespace
+		for _, service := range opts.Services {
+			if service.Namespace != namespaceName {
+				return metav1.NamespaceAll
+			}
+		}
+		return namespaceName
+	}
+	if ListsServices(opts) && opts.AllNamespaces {
+		return metav1.NamespaceAll
+	}
+	return opts.Namespace
+}
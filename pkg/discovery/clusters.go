@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	"context"
+
+	core "k8s.io/api/core/v1"
+)
+
+// Cluster is a Kubernetes cluster whose endpoints are aggregated with those of other clusters
+type Cluster struct {
+	Name       string
+	Discoverer *Discoverer
+	// Domain replaces Options.Domain in the FQDNs of the cluster endpoints when set
+	Domain string
+}
+
+// WaitClusters polls the services in every cluster until the aggregated endpoints meet the
+// expected count, the timeout expires or the context is cancelled. With the per-service count
+// scope, each service must have the count in every cluster.
+func WaitClusters(ctx context.Context, clusters []Cluster, opts Options) (*Result, error) {
+	return waitUntilMet(ctx, opts, func() *Result {
+		return PollClusters(ctx, clusters, opts)
+	})
+}
+
+// PollClusters reads the current endpoints of the services in every cluster once
+func PollClusters(ctx context.Context, clusters []Cluster, opts Options) *Result {
+	aggregated := &Result{Endpoints: []Endpoint{}, Objects: []*core.Endpoints{}, Met: len(clusters) > 0}
+	for _, cluster := range clusters {
+		clusterOpts := opts
+		if cluster.Domain != "" {
+			clusterOpts.Domain = cluster.Domain
+		}
+		result := cluster.Discoverer.Poll(ctx, clusterOpts)
+		for _, endpoint := range result.Endpoints {
+			endpoint.Cluster = cluster.Name
+			aggregated.Endpoints = append(aggregated.Endpoints, endpoint)
+		}
+		aggregated.Objects = append(aggregated.Objects, result.Objects...)
+		if result.Err != nil {
+			aggregated.Err = result.Err
+		}
+		aggregated.Met = aggregated.Met && result.Met
+	}
+	if opts.CountScope != "per-service" {
+		aggregated.Met = countMet(opts, len(aggregated.Endpoints))
+	}
+	return aggregated
+}
@@ -0,0 +1,768 @@
+/*
+
+Package discovery finds the endpoints of Kubernetes services and constructs their DNS names.
+
+*/
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The APIs endpoints can be read from
+const (
+	BackendEndpoints      = "endpoints"
+	BackendEndpointSlices = "endpointslices"
+	// BackendAuto uses EndpointSlices when the API server serves them
+	BackendAuto = "auto"
+	// BackendDNS resolves the DNS records of the headless service, reading the Endpoints
+	// only when the records can't be resolved
+	BackendDNS = "dns"
+)
+
+// ErrTimeout is returned when the expected endpoint count isn't reached in time
+var ErrTimeout = errors.New("timed out waiting for endpoints")
+
+// Endpoint is a discovered service endpoint
+type Endpoint struct {
+	Hostname string
+	// FQDN is the name emitted for the endpoint, shortened when a search name style is used
+	FQDN string
+	// IP is the IPv4 address of a dual-stack endpoint, and IPs its addresses of every family, IP
+	// first
+	IP  string
+	IPs []string
+	// Port is the first of Ports, 0 when the endpoint exposes none
+	Port     int32
+	Ports    []Port
+	NodeName string
+	// Zone is the zone of the EndpointSlice endpoint, empty with the Endpoints backend
+	Zone string
+	// PodName and PodUID identify the pod the endpoint targets, empty when it doesn't target a pod
+	PodName   string
+	PodUID    string
+	Namespace string
+	Service   string
+	Ready     bool
+	// Cluster is the name of the cluster of the endpoint when several are aggregated
+	Cluster string
+}
+
+// Port is a port exposed by an endpoint
+type Port struct {
+	Name     string
+	Port     int32
+	Protocol string
+}
+
+// Options configures a discovery run
+type Options struct {
+	Namespace string
+	Service   string
+	// ServiceRegex discovers every service of the namespace whose name matches, instead of Service
+	ServiceRegex *regexp.Regexp
+	// ServiceSelector discovers every service matching the label selector, further filtered
+	// by ServiceRegex when both are set
+	ServiceSelector string
+	// AllNamespaces lists the services of every namespace with ServiceSelector and ServiceRegex,
+	// or the services named Service in every namespace without them
+	AllNamespaces bool
+	// Services discovers several services, possibly of other namespaces, instead of Service
+	// and ServiceRegex
+	Services []ServiceRef
+	Domain   string
+	// Count is the number of endpoints to wait for, compared with CountOp
+	Count int
+	// CountOp is CountExactly (the default when empty) to wait for exactly Count endpoints, or
+	// CountAtLeast to also accept more of them
+	CountOp string
+	// CountScope applies Count to all services together ("aggregate", the default) or to each one ("per-service")
+	CountScope string
+	// Backend is one of the Backend constants, BackendEndpoints when empty
+	Backend string
+	// DNSTTL re-resolves the records of the DNS backend once their TTL expires when watching,
+	// instead of every Interval
+	DNSTTL bool
+	// LoadBalancer emits the load balancer ingress IPs or hostnames of the services instead of
+	// their endpoints. ExternalName services always emit their external name.
+	LoadBalancer bool
+	// PodSelector builds the endpoints of Service from the pods matching the selector instead of
+	// reading its Endpoints, so that the pods are discovered before the service exists
+	PodSelector labels.Selector
+	// PageSize limits the number of objects returned by each List call, 0 means no limit
+	PageSize int64
+	// PortName and PortNumber keep only the subsets exposing a matching port when set
+	PortName   string
+	PortNumber int32
+	// NameStyle "search" shortens the FQDNs by the longest of SearchDomains they end with
+	NameStyle     string
+	SearchDomains []string
+	// HostnameSources is the fallback chain naming the addresses without a hostname,
+	// DefaultHostnameSources when empty
+	HostnameSources []string
+	// AddressType "ip" emits the endpoint IPs instead of the FQDNs, "auto" only for addresses
+	// without a hostname
+	AddressType string
+	// AddressFamily "ipv4" or "ipv6" keeps only the addresses of the family, "dual" or empty keeps
+	// both, the addresses of a dual-stack pod making up a single endpoint
+	AddressFamily string
+	// IncludeNotReady also discovers the not-ready addresses, which is what a cluster whose
+	// pods only become ready once it is formed needs to bootstrap
+	IncludeNotReady bool
+	// MemberAnnotation keeps only the endpoints whose target pod has the annotation set to MemberValue
+	MemberAnnotation string
+	MemberValue      string
+	// Zone and NodeSelector keep only the endpoints whose node is in the availability zone and
+	// has matching labels
+	Zone         string
+	NodeSelector labels.Selector
+	// Sort is "ordinal" (the default when empty), "hostname", "ip", "weight", "first-seen" or
+	// "none" to keep the API order
+	Sort string
+	// OrdinalRegex extracts the ordinal the endpoints are sorted by from the hostnames with its
+	// first group, the StatefulSet ordinal when nil
+	OrdinalRegex     *regexp.Regexp
+	WeightAnnotation string
+	WeightDefault    float64
+	// ProbePort, when set, keeps only the endpoints accepting TCP connections on the port, dialed
+	// with ProbeTimeout, 2 seconds when zero. With the ProbeMode "exclude" the count is checked
+	// before leaving the unreachable endpoints out, with "wait" or empty they don't count.
+	ProbePort    int32
+	ProbeTimeout time.Duration
+	ProbeMode    string
+	// Timeout and Interval control the wait loop, 5 minutes and 10 seconds when zero. The delay
+	// between polls doubles from Interval up to MaxInterval, with some jitter.
+	Timeout     time.Duration
+	Interval    time.Duration
+	MaxInterval time.Duration
+	// Stats receives a summary of every endpoints object read when set
+	Stats io.Writer
+	// OnPoll is called with the result of every poll when set
+	OnPoll func(*Result)
+}
+
+// ServiceRef identifies a service
+type ServiceRef struct {
+	Namespace string
+	Name      string
+}
+
+func (r ServiceRef) String() string {
+	return r.Namespace + "/" + r.Name
+}
+
+// ParseServiceRefs parses a comma separated list of [namespace/]service references,
+// defaulting to the namespace
+func ParseServiceRefs(value string, namespaceName string) ([]ServiceRef, error) {
+	refs := []ServiceRef{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		ref := ServiceRef{Namespace: namespaceName, Name: item}
+		if i := strings.Index(item, "/"); i >= 0 {
+			ref.Namespace, ref.Name = item[:i], item[i+1:]
+		}
+		if ref.Name == "" || ref.Namespace == "" {
+			return nil, fmt.Errorf("invalid service reference %q", item)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// Result is the outcome of a single poll
+type Result struct {
+	Endpoints []Endpoint
+	// Objects are the endpoints objects the endpoints were read from
+	Objects []*core.Endpoints
+	// Met reports whether the expected count was reached
+	Met bool
+	// Err is the last error returned by the API during the poll, if any
+	Err error
+}
+
+// Discoverer discovers service endpoints through the Kubernetes API. Pod and node lookups
+// and the first-seen order are kept for the lifetime of the Discoverer.
+type Discoverer struct {
+	clientset kubernetes.Interface
+	lookups   *lookupCache
+	firstSeen *seenOrder
+	cache     *endpointsCache
+	fixture   map[ServiceRef]*core.Endpoints
+}
+
+// Interface is the discovery of endpoints implemented by Discoverer, for callers substituting
+// their own. A Discoverer itself runs against any kubernetes.Interface, the fake clientset of
+// k8s.io/client-go/kubernetes/fake included.
+type Interface interface {
+	Discover(ctx context.Context, opts Options) ([]Endpoint, error)
+	Wait(ctx context.Context, opts Options) (*Result, error)
+	Poll(ctx context.Context, opts Options) *Result
+}
+
+var _ Interface = &Discoverer{}
+
+// NewDiscoverer creates a Discoverer using the clientset
+func NewDiscoverer(clientset kubernetes.Interface) *Discoverer {
+	return &Discoverer{
+		clientset: clientset,
+		lookups:   newLookupCache(clientset),
+		firstSeen: newSeenOrder(),
+	}
+}
+
+// Discover waits for the expected number of endpoints and returns them. When the timeout
+// expires the endpoints of the last poll are returned along with ErrTimeout.
+func (d *Discoverer) Discover(ctx context.Context, opts Options) ([]Endpoint, error) {
+	result, err := d.Wait(ctx, opts)
+	return result.Endpoints, err
+}
+
+// Wait polls the services until the expected count is met, the timeout expires, the context is
+// cancelled or the API denies or rejects a request, returning the last poll result
+func (d *Discoverer) Wait(ctx context.Context, opts Options) (*Result, error) {
+	services := []ServiceRef{}
+	result := &Result{Endpoints: []Endpoint{}}
+	return waitUntilMet(ctx, opts, func() *Result {
+		if !ListsServices(opts) {
+			return d.Poll(ctx, opts)
+		}
+		matched, err := d.getMatchingServices(ctx, opts)
+		if err != nil {
+			logReadError("list services", err, "namespace", opts.Namespace)
+			result.Err = err
+			return result
+		}
+		if fmt.Sprint(matched) != fmt.Sprint(services) {
+			log.Infof("Matching services: %s", matched)
+		}
+		services = matched
+		result = d.collect(ctx, opts, services)
+		return result
+	})
+}
+
+// waitUntilMet calls poll until its result meets the expected count, the timeout expires, the
+// context is cancelled or the API returns a permanent error, returning the last result
+func waitUntilMet(ctx context.Context, opts Options, poll func() *Result) (*Result, error) {
+	deadline := time.After(waitTimeout(opts))
+	backoff := newBackoff(opts)
+	for {
+		result := poll()
+		log.Info("Waiting for primary service", "found", len(result.Endpoints), "expected", opts.Count,
+			"endpoints", strings.Join(Names(result.Endpoints), ","))
+		if result.Met {
+			return result, nil
+		}
+		// retrying a denied or invalid request only delays the failure
+		if IsPermanent(result.Err) {
+			return result, result.Err
+		}
+		select {
+		case <-ctx.Done():
+			return result, contextError(ctx)
+		case <-deadline:
+			return result, ErrTimeout
+		case <-time.After(retryDelay(result.Err, backoff.delay())):
+		}
+	}
+}
+
+// Poll reads the current endpoints of the services once
+func (d *Discoverer) Poll(ctx context.Context, opts Options) *Result {
+	return d.collect(ctx, opts, d.resolveServices(ctx, opts))
+}
+
+// WaitForCount polls a service until it has at least count ready addresses, the timeout
+// expires or the context is cancelled
+func (d *Discoverer) WaitForCount(ctx context.Context, opts Options, namespaceName string, serviceName string, count int) error {
+	deadline := time.After(waitTimeout(opts))
+	backoff := newBackoff(opts)
+	for {
+		endpoints, err := d.getEndpoints(ctx, opts, namespaceName, serviceName)
+		if err != nil {
+			log.Infof("Waiting for dependency %s/%s: %v", namespaceName, serviceName, err)
+		} else {
+			ready := countAddresses(endpoints.Subsets, false)
+			log.Infof("Waiting for dependency %s/%s: %d of %d ready", namespaceName, serviceName, ready, count)
+			if ready >= count {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return contextError(ctx)
+		case <-deadline:
+			return ErrTimeout
+		case <-time.After(backoff.delay()):
+		}
+	}
+}
+
+// contextError reports an expired context deadline as ErrTimeout so that callers sharing
+// a deadline across several waits see the same error as for the wait's own timeout
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return ctx.Err()
+}
+
+func waitTimeout(opts Options) time.Duration {
+	if opts.Timeout == 0 {
+		return 5 * time.Minute
+	}
+	return opts.Timeout
+}
+
+func waitInterval(opts Options) time.Duration {
+	if opts.Interval == 0 {
+		return 10 * time.Second
+	}
+	return opts.Interval
+}
+
+// Names returns the emitted names of the endpoints
+func Names(endpoints []Endpoint) []string {
+	names := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		names = append(names, endpoint.FQDN)
+	}
+	return names
+}
+
+// getFqdn constructs the FQDN of a hostname of the service
+func getFqdn(hostname string, namespaceName string, serviceName string, domainName string) string {
+	return hostname + "." + serviceName + "." + namespaceName + "." + "svc" + "." + domainName
+}
+
+// countAddresses returns the number of ready addresses of the endpoint subsets, and of not-ready
+// ones too when include is set
+func countAddresses(subsets []core.EndpointSubset, include bool) int {
+	count := 0
+	for _, ss := range subsets {
+		count += len(ss.Addresses)
+		if include {
+			count += len(ss.NotReadyAddresses)
+		}
+	}
+	return count
+}
+
+// FilterSubsets keeps the subsets exposing a port with the name and number, narrowing their ports
+// to the matching one. An empty name or zero number matches any port.
+func FilterSubsets(subsets []core.EndpointSubset, portName string, portNumber int32) []core.EndpointSubset {
+	if portName == "" && portNumber == 0 {
+		return subsets
+	}
+	filtered := []core.EndpointSubset{}
+	for _, ss := range subsets {
+		for _, port := range ss.Ports {
+			if (portName == "" || port.Name == portName) && (portNumber == 0 || port.Port == portNumber) {
+				ss.Ports = []core.EndpointPort{port}
+				filtered = append(filtered, ss)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// FilterPort keeps the endpoints exposing the named port, narrowing their ports to it. It fails
+// when there are endpoints but none of them exposes the port, which is then likely misspelled.
+func FilterPort(endpoints []Endpoint, portName string) ([]Endpoint, error) {
+	filtered := []Endpoint{}
+	for _, endpoint := range endpoints {
+		for _, port := range endpoint.Ports {
+			if port.Name == portName {
+				endpoint.Port, endpoint.Ports = port.Port, []Port{port}
+				filtered = append(filtered, endpoint)
+				break
+			}
+		}
+	}
+	if len(filtered) == 0 && len(endpoints) > 0 {
+		return nil, fmt.Errorf("no endpoint exposes the port %q", portName)
+	}
+	return filtered, nil
+}
+
+// subsetPorts returns the ports of the subset, shared by the endpoints of its addresses
+func subsetPorts(ss core.EndpointSubset) []Port {
+	ports := make([]Port, 0, len(ss.Ports))
+	for _, port := range ss.Ports {
+		ports = append(ports, Port{Name: port.Name, Port: port.Port, Protocol: string(port.Protocol)})
+	}
+	return ports
+}
+
+// trimSearchDomain shortens the FQDN by the longest search domain it ends with, leaving a
+// name that no search domain would resolve untouched
+func trimSearchDomain(fqdn string, searchDomains []string) string {
+	name := fqdn
+	for _, domain := range searchDomains {
+		if short := strings.TrimSuffix(fqdn, "."+domain); short != fqdn && len(short) < len(name) {
+			name = short
+		}
+	}
+	return name
+}
+
+// getEndpoints fetches the endpoints object of the service, building it from the
+// EndpointSlices or the DNS records of the service when that backend is used, or from the
+// Service itself for load balancers and ExternalName services
+func (d *Discoverer) getEndpoints(ctx context.Context, opts Options, namespaceName string, serviceName string) (*core.Endpoints, error) {
+	if d.fixture != nil {
+		return d.getFixture(namespaceName, serviceName)
+	}
+	if opts.LoadBalancer {
+		return d.getServiceEndpoints(ctx, namespaceName, serviceName)
+	}
+	if opts.PodSelector != nil && d.cache == nil {
+		return getPodEndpoints(ctx, d.clientset, opts, namespaceName, serviceName)
+	}
+	endpoints, err := d.readEndpoints(ctx, opts, namespaceName, serviceName)
+	if opts.PodSelector == nil && opts.Backend != BackendDNS && isMissing(opts.Backend, endpoints, err) {
+		if external := d.getExternalName(ctx, namespaceName, serviceName); external != nil {
+			return external, nil
+		}
+	}
+	return endpoints, err
+}
+
+// readEndpoints reads the endpoints object of the service from the configured backend
+func (d *Discoverer) readEndpoints(ctx context.Context, opts Options, namespaceName string, serviceName string) (*core.Endpoints, error) {
+	if opts.Backend == BackendDNS {
+		endpoints, err := getDNSEndpoints(ctx, opts, namespaceName, serviceName)
+		if err == nil {
+			return endpoints, nil
+		}
+		log.Warn("Unable to resolve the service records, reading the Endpoints", "namespace", namespaceName, "service", serviceName, "error", err)
+	}
+	if d.cache != nil {
+		return d.cache.get(namespaceName, serviceName)
+	}
+	if opts.Backend == BackendEndpointSlices {
+		slices, err := getEndpointSlices(ctx, d.clientset, namespaceName, serviceName, opts.PageSize)
+		if err != nil {
+			return nil, err
+		}
+		return slicesToEndpoints(namespaceName, serviceName, slices), nil
+	}
+	return d.clientset.CoreV1().Endpoints(namespaceName).Get(ctx, serviceName, metav1.GetOptions{})
+}
+
+// The comparisons of the endpoint count with Options.Count
+const (
+	CountExactly = "=="
+	CountAtLeast = ">="
+)
+
+// countMet reports whether the number of endpoints found meets the expected count, no endpoint
+// never meeting it
+func countMet(opts Options, found int) bool {
+	if opts.CountOp == CountAtLeast {
+		return found > 0 && found >= opts.Count
+	}
+	return found > 0 && found == opts.Count
+}
+
+// ListsServices reports whether the services to discover are found by listing them: the
+// matches of ServiceSelector and ServiceRegex, or the services named Service in every namespace
+// with AllNamespaces
+func ListsServices(opts Options) bool {
+	return len(opts.Services) == 0 && (opts.ServiceRegex != nil || opts.ServiceSelector != "" || (opts.AllNamespaces && opts.Service != ""))
+}
+
+// getMatchingServices lists the services matching the label selector and the regex, or named
+// Service without them, following the List continuation tokens so that every page is inspected.
+// They're read from the cache when one was started.
+func (d *Discoverer) getMatchingServices(ctx context.Context, opts Options) ([]ServiceRef, error) {
+	refs := []ServiceRef{}
+	namespaceName := opts.Namespace
+	if opts.AllNamespaces {
+		namespaceName = metav1.NamespaceAll
+	}
+	if d.cache != nil && d.cache.services != nil {
+		refs, err := d.cache.matchingServices(namespaceName, opts)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+		return refs, nil
+	}
+	options := metav1.ListOptions{Limit: opts.PageSize, LabelSelector: opts.ServiceSelector}
+	if opts.ServiceSelector == "" && opts.ServiceRegex == nil {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", opts.Service).String()
+	}
+	for {
+		services, err := d.clientset.CoreV1().Services(namespaceName).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range services.Items {
+			if opts.ServiceRegex == nil || opts.ServiceRegex.MatchString(service.Name) {
+				refs = append(refs, ServiceRef{Namespace: service.Namespace, Name: service.Name})
+			}
+		}
+		if services.Continue == "" {
+			break
+		}
+		options.Continue = services.Continue
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	return refs, nil
+}
+
+// resolveServices returns the services to discover, listing the regex matches when configured
+func (d *Discoverer) resolveServices(ctx context.Context, opts Options) []ServiceRef {
+	if len(opts.Services) > 0 {
+		return opts.Services
+	}
+	if !ListsServices(opts) {
+		return []ServiceRef{{Namespace: opts.Namespace, Name: opts.Service}}
+	}
+	matched, err := d.getMatchingServices(ctx, opts)
+	if err != nil {
+		logReadError("list services", err, "namespace", opts.Namespace)
+		return []ServiceRef{}
+	}
+	return matched
+}
+
+// collect gathers the endpoints of all services and checks them against the expected count,
+// stopping early when the context is done
+func (d *Discoverer) collect(ctx context.Context, opts Options, services []ServiceRef) *Result {
+	result := &Result{Endpoints: []Endpoint{}, Objects: []*core.Endpoints{}}
+	weights := map[string]float64{}
+	perServiceMet := len(services) > 0
+	found := 0
+	for _, service := range services {
+		if ctx.Err() != nil {
+			result.Err = ctx.Err()
+			perServiceMet = false
+			break
+		}
+		endpoints, err := d.getEndpoints(ctx, opts, service.Namespace, service.Name)
+		if err != nil {
+			logReadError("read the endpoints", err, "namespace", service.Namespace, "service", service.Name)
+			result.Err = err
+			perServiceMet = false
+			continue
+		}
+		result.Objects = append(result.Objects, endpoints)
+		if opts.Stats != nil {
+			fmt.Fprint(opts.Stats, FormatStats(endpoints))
+		}
+		serviceEndpoints := d.convert(ctx, opts, service, endpoints, weights)
+		counted := len(serviceEndpoints)
+		if opts.ProbePort != 0 {
+			serviceEndpoints = probeEndpoints(ctx, opts, serviceEndpoints)
+			if opts.ProbeMode != "exclude" {
+				counted = len(serviceEndpoints)
+			}
+		}
+		if !countMet(opts, counted) {
+			perServiceMet = false
+		}
+		found += counted
+		result.Endpoints = append(result.Endpoints, serviceEndpoints...)
+	}
+	if opts.Sort == "first-seen" {
+		d.firstSeen.observeServices(result.Objects)
+	}
+	d.sort(opts, result.Endpoints, weights, result.Err == nil)
+	if opts.CountScope == "per-service" {
+		result.Met = perServiceMet
+	} else {
+		result.Met = countMet(opts, found)
+	}
+	if opts.OnPoll != nil {
+		opts.OnPoll(result)
+	}
+	return result
+}
+
+// ServiceEndpoints reads the endpoints of a single service, applying the same filters and
+// ordering as a poll
+func (d *Discoverer) ServiceEndpoints(ctx context.Context, opts Options, namespaceName string, serviceName string) ([]Endpoint, error) {
+	endpoints, err := d.getEndpoints(ctx, opts, namespaceName, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return d.FromEndpoints(ctx, opts, endpoints), nil
+}
+
+// FromEndpoints converts an endpoints object read elsewhere, e.g. from an informer cache,
+// applying the same filters and ordering as a poll
+func (d *Discoverer) FromEndpoints(ctx context.Context, opts Options, endpoints *core.Endpoints) []Endpoint {
+	weights := map[string]float64{}
+	result := d.convert(ctx, opts, ServiceRef{Namespace: endpoints.Namespace, Name: endpoints.Name}, endpoints, weights)
+	d.sort(opts, result, weights, false)
+	return result
+}
+
+// convert builds the endpoints of the service from its endpoints object in a stable order,
+// recording the weight of each one when sorting by weight. The addresses are read in place,
+// the subsets of a large service not being copied on every poll.
+func (d *Discoverer) convert(ctx context.Context, opts Options, service ServiceRef, endpoints *core.Endpoints, weights map[string]float64) []Endpoint {
+	subsets := FilterSubsets(endpoints.Subsets, opts.PortName, opts.PortNumber)
+	result := make([]Endpoint, 0, countAddresses(subsets, opts.IncludeNotReady))
+	external := endpoints.Annotations[externalAnnotation] == "true"
+	for _, ss := range subsets {
+		ports := subsetPorts(ss)
+		for i := range ss.Addresses {
+			result = d.appendEndpoint(ctx, opts, service, &ss.Addresses[i], ports, true, external, result, weights)
+		}
+		if opts.IncludeNotReady {
+			for i := range ss.NotReadyAddresses {
+				result = d.appendEndpoint(ctx, opts, service, &ss.NotReadyAddresses[i], ports, false, external, result, weights)
+			}
+		}
+	}
+	if zones := sliceZones(endpoints); len(zones) > 0 {
+		for i := range result {
+			result[i].Zone = zones[result[i].IP]
+		}
+	}
+	result = mergeFamilies(result, weights)
+	sortService(opts.Sort, opts.OrdinalRegex, result)
+	return result
+}
+
+// appendEndpoint appends the endpoint of the address to the result unless it's filtered out
+func (d *Discoverer) appendEndpoint(ctx context.Context, opts Options, service ServiceRef, address *core.EndpointAddress, ports []Port,
+	ready bool, external bool, result []Endpoint, weights map[string]float64) []Endpoint {
+	if !inAddressFamily(address.IP, opts.AddressFamily) {
+		return result
+	}
+	if opts.MemberAnnotation != "" && !isMember(ctx, d.lookups, *address, opts.MemberAnnotation, opts.MemberValue) {
+		return result
+	}
+	if (opts.Zone != "" || opts.NodeSelector != nil) && !d.inTopology(ctx, opts, *address) {
+		return result
+	}
+	hostname, name := d.hostname(ctx, opts, service, *address)
+	if opts.NameStyle == "search" {
+		name = trimSearchDomain(name, opts.SearchDomains)
+	}
+	if external {
+		hostname, name = address.Hostname, externalName(*address, opts.AddressType)
+	} else if opts.AddressType == "ip" || (opts.AddressType == "auto" && address.Hostname == "") {
+		name = address.IP
+	}
+	endpoint := Endpoint{
+		Hostname:  hostname,
+		FQDN:      name,
+		IP:        address.IP,
+		IPs:       []string{address.IP},
+		Ports:     ports,
+		Namespace: service.Namespace,
+		Service:   service.Name,
+		Ready:     ready,
+	}
+	if len(ports) > 0 {
+		endpoint.Port = ports[0].Port
+	}
+	if address.NodeName != nil {
+		endpoint.NodeName = *address.NodeName
+	}
+	if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+		endpoint.PodName, endpoint.PodUID = address.TargetRef.Name, string(address.TargetRef.UID)
+	}
+	if opts.Sort == "weight" {
+		weights[name] = getWeight(ctx, d.lookups, *address, opts.WeightAnnotation, opts.WeightDefault)
+	}
+	return append(result, endpoint)
+}
+
+// inAddressFamily reports whether the IP is of the address family, addresses without an IP such
+// as external names being of every family
+func inAddressFamily(ip string, family string) bool {
+	if ip == "" || (family != "ipv4" && family != "ipv6") {
+		return true
+	}
+	return isIPv6(ip) == (family == "ipv6")
+}
+
+// mergeFamilies merges the endpoints of a dual-stack pod, read from the EndpointSlices of each
+// address family, into one holding the addresses of both families. The endpoints are those of
+// the same target pod, or with the same hostname when they don't target one, that have the same
+// readiness and no address of the same family: an endpoint listed once per port set keeps doing so.
+func mergeFamilies(endpoints []Endpoint, weights map[string]float64) []Endpoint {
+	merged := endpoints[:0]
+	seen := map[string]int{}
+	for _, endpoint := range endpoints {
+		key := ""
+		switch {
+		case endpoint.PodName != "":
+			key = "pod/" + endpoint.Namespace + "/" + endpoint.PodName
+		case endpoint.Hostname != "" && endpoint.IP != "":
+			key = "hostname/" + endpoint.Hostname
+		}
+		i, ok := seen[key]
+		if key == "" || !ok || !mergeable(merged[i], endpoint) {
+			if key != "" && !ok {
+				seen[key] = len(merged)
+			}
+			merged = append(merged, endpoint)
+			continue
+		}
+		target := &merged[i]
+		if isIPv6(target.IP) && !isIPv6(endpoint.IP) {
+			// the IPv4 address is the main one, as on a single-stack cluster
+			if target.FQDN == target.IP {
+				weights[endpoint.IP] = weights[target.FQDN]
+				target.FQDN = endpoint.IP
+			}
+			target.IP, target.IPs = endpoint.IP, append([]string{endpoint.IP}, target.IPs...)
+		} else {
+			target.IPs = append(target.IPs, endpoint.IP)
+		}
+	}
+	return merged
+}
+
+// mergeable reports whether the endpoint is the address of another family of the merged one
+func mergeable(merged Endpoint, endpoint Endpoint) bool {
+	if merged.Ready != endpoint.Ready {
+		return false
+	}
+	for _, ip := range merged.IPs {
+		if ip != "" && isIPv6(ip) == isIPv6(endpoint.IP) {
+			return false
+		}
+	}
+	return true
+}
+
+// isIPv6 reports whether the IP is an IPv6 address
+func isIPv6(ip string) bool {
+	return strings.Contains(ip, ":")
+}
+
+// sort orders the endpoints of all services by weight or first-seen position, the other modes
+// being applied per service by convert. Only the endpoints of a complete poll, all of its
+// services read, replace the first-seen positions of the previous ones.
+func (d *Discoverer) sort(opts Options, endpoints []Endpoint, weights map[string]float64, complete bool) {
+	switch opts.Sort {
+	case "weight":
+		sortByWeight(endpoints, weights, opts.OrdinalRegex)
+	case "first-seen":
+		d.firstSeen.sort(endpoints, complete)
+	}
+}
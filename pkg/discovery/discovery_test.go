@@ -0,0 +1,289 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testEndpoints returns the Endpoints of the zk-hs service with the ready zk-<ordinal> pods and
+// the not-ready ones
+func testEndpoints(ready []int, notReady []int) *core.Endpoints {
+	subset := core.EndpointSubset{Ports: []core.EndpointPort{{Name: "client", Port: 2181, Protocol: core.ProtocolTCP}}}
+	for _, ordinal := range ready {
+		subset.Addresses = append(subset.Addresses, testAddress(ordinal))
+	}
+	for _, ordinal := range notReady {
+		subset.NotReadyAddresses = append(subset.NotReadyAddresses, testAddress(ordinal))
+	}
+	return &core.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "zk-hs", Namespace: "default"},
+		Subsets:    []core.EndpointSubset{subset},
+	}
+}
+
+func testAddress(ordinal int) core.EndpointAddress {
+	name := "zk-" + string(rune('0'+ordinal))
+	return core.EndpointAddress{
+		IP:        "10.0.0." + string(rune('0'+ordinal)),
+		Hostname:  name,
+		TargetRef: &core.ObjectReference{Kind: "Pod", Namespace: "default", Name: name},
+	}
+}
+
+func testOptions(count int) Options {
+	return Options{Namespace: "default", Service: "zk-hs", Domain: "cluster.local", Count: count}
+}
+
+func TestPoll(t *testing.T) {
+	// the addresses are listed out of order, the endpoints come sorted by ordinal
+	d := NewDiscoverer(fake.NewSimpleClientset(testEndpoints([]int{2, 0, 1}, nil)))
+	result := d.Poll(context.Background(), testOptions(3))
+	if result.Err != nil || !result.Met {
+		t.Fatalf("Poll() = %+v, want the count met", result)
+	}
+	want := []string{
+		"zk-0.zk-hs.default.svc.cluster.local",
+		"zk-1.zk-hs.default.svc.cluster.local",
+		"zk-2.zk-hs.default.svc.cluster.local",
+	}
+	if got := Names(result.Endpoints); !reflect.DeepEqual(got, want) {
+		t.Errorf("Poll() names = %v, want %v", got, want)
+	}
+	if endpoint := result.Endpoints[0]; endpoint.IP != "10.0.0.0" || endpoint.Port != 2181 || endpoint.PodName != "zk-0" || !endpoint.Ready {
+		t.Errorf("Poll() first endpoint = %+v", endpoint)
+	}
+}
+
+func TestPollCount(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		endpoints *core.Endpoints
+		opts      Options
+		found     int
+		met       bool
+	}{
+		{"exact", testEndpoints([]int{0, 1, 2}, nil), testOptions(3), 3, true},
+		{"too few", testEndpoints([]int{0, 1}, nil), testOptions(3), 2, false},
+		{"too many", testEndpoints([]int{0, 1, 2, 3}, nil), testOptions(3), 4, false},
+		{"at least", testEndpoints([]int{0, 1, 2, 3}, nil), Options{Namespace: "default", Service: "zk-hs", Count: 3, CountOp: CountAtLeast}, 4, true},
+		{"not ready left out", testEndpoints([]int{0, 1}, []int{2}), testOptions(3), 2, false},
+		{"not ready included", testEndpoints([]int{0, 1}, []int{2}), Options{Namespace: "default", Service: "zk-hs", Count: 3, IncludeNotReady: true}, 3, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			d := NewDiscoverer(fake.NewSimpleClientset(c.endpoints))
+			result := d.Poll(context.Background(), c.opts)
+			if len(result.Endpoints) != c.found || result.Met != c.met {
+				t.Errorf("Poll() found %d met %v, want %d and %v", len(result.Endpoints), result.Met, c.found, c.met)
+			}
+		})
+	}
+}
+
+func TestPollMissingService(t *testing.T) {
+	d := NewDiscoverer(fake.NewSimpleClientset())
+	result := d.Poll(context.Background(), testOptions(1))
+	if result.Met || !errors.IsNotFound(result.Err) {
+		t.Errorf("Poll() = %+v, want a not found error", result)
+	}
+}
+
+func TestDiscoverTimeout(t *testing.T) {
+	d := NewDiscoverer(fake.NewSimpleClientset(testEndpoints([]int{0}, nil)))
+	opts := testOptions(3)
+	opts.Timeout, opts.Interval, opts.MaxInterval = 50*time.Millisecond, 10*time.Millisecond, 10*time.Millisecond
+	endpoints, err := d.Discover(context.Background(), opts)
+	if err != ErrTimeout || len(endpoints) != 1 {
+		t.Errorf("Discover() = %v, %v, want the endpoint of the last poll and ErrTimeout", Names(endpoints), err)
+	}
+}
+
+func TestPollEndpointSlices(t *testing.T) {
+	ready, notReady := true, false
+	port, portName := int32(2181), "client"
+	hostname := func(name string) *string { return &name }
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: "zk-hs-abc", Namespace: "default", Labels: map[string]string{discoveryv1.LabelServiceName: "zk-hs"}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}, Hostname: hostname("zk-1"), Conditions: discoveryv1.EndpointConditions{Ready: &ready}},
+			{Addresses: []string{"10.0.0.0"}, Hostname: hostname("zk-0")},
+			{Addresses: []string{"10.0.0.2"}, Hostname: hostname("zk-2"), Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+		},
+	}
+	d := NewDiscoverer(fake.NewSimpleClientset(slice))
+	opts := testOptions(2)
+	opts.Backend = BackendEndpointSlices
+	result := d.Poll(context.Background(), opts)
+	want := []string{"zk-0.zk-hs.default.svc.cluster.local", "zk-1.zk-hs.default.svc.cluster.local"}
+	if got := Names(result.Endpoints); !result.Met || !reflect.DeepEqual(got, want) {
+		t.Errorf("Poll() = %v met %v, want %v", got, result.Met, want)
+	}
+}
+
+func TestFilterPort(t *testing.T) {
+	// the peer port is exposed by a subset of its own, on zk-0 and zk-1 only
+	endpoints := testEndpoints([]int{0, 1, 2}, nil)
+	peers := core.EndpointSubset{
+		Addresses: []core.EndpointAddress{testAddress(0), testAddress(1)},
+		Ports:     []core.EndpointPort{{Name: "peer", Port: 2888, Protocol: core.ProtocolTCP}},
+	}
+	endpoints.Subsets = append(endpoints.Subsets, peers)
+	result := NewDiscoverer(fake.NewSimpleClientset(endpoints)).Poll(context.Background(), Options{Namespace: "default", Service: "zk-hs", Sort: "hostname"})
+	for _, c := range []struct {
+		port  string
+		names []string
+		want  int32
+	}{
+		{"client", []string{"zk-0", "zk-1", "zk-2"}, 2181},
+		{"peer", []string{"zk-0", "zk-1"}, 2888},
+	} {
+		t.Run(c.port, func(t *testing.T) {
+			filtered, err := FilterPort(result.Endpoints, c.port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hostnames(filtered); !reflect.DeepEqual(got, c.names) {
+				t.Errorf("FilterPort() = %v, want %v", got, c.names)
+			}
+			for _, endpoint := range filtered {
+				if endpoint.Port != c.want || len(endpoint.Ports) != 1 || endpoint.Ports[0].Name != c.port {
+					t.Errorf("FilterPort() endpoint %s ports = %d %v, want only %s", endpoint.Hostname, endpoint.Port, endpoint.Ports, c.port)
+				}
+			}
+		})
+	}
+	if _, err := FilterPort(result.Endpoints, "leader-election"); err == nil {
+		t.Error("FilterPort() of a port no endpoint exposes should fail")
+	}
+	if filtered, err := FilterPort(nil, "peer"); err != nil || len(filtered) != 0 {
+		t.Errorf("FilterPort() without endpoints = %v, %v, want none", filtered, err)
+	}
+}
+
+func TestFilterSubsetsPortNumber(t *testing.T) {
+	subset := func(ordinal int, ports ...core.EndpointPort) core.EndpointSubset {
+		return core.EndpointSubset{Addresses: []core.EndpointAddress{testAddress(ordinal)}, Ports: ports}
+	}
+	unnamed := func(port int32) core.EndpointPort { return core.EndpointPort{Port: port, Protocol: core.ProtocolTCP} }
+	named := func(name string, port int32) core.EndpointPort {
+		return core.EndpointPort{Name: name, Port: port, Protocol: core.ProtocolTCP}
+	}
+	for _, c := range []struct {
+		name       string
+		subsets    []core.EndpointSubset
+		portName   string
+		portNumber int32
+		// want are the hostnames and ports of the subsets kept
+		want []string
+	}{
+		{"single unnamed port", []core.EndpointSubset{subset(0, unnamed(2181)), subset(1, unnamed(8080))}, "", 2181, []string{"zk-0:2181"}},
+		{"single unnamed port missing", []core.EndpointSubset{subset(0, unnamed(2181))}, "", 3888, []string{}},
+		{"multiple unnamed ports", []core.EndpointSubset{subset(0, unnamed(2181), unnamed(2888), unnamed(3888))}, "", 2888, []string{"zk-0:2888"}},
+		{"multiple unnamed ports across subsets", []core.EndpointSubset{subset(0, unnamed(2181), unnamed(2888)), subset(1, unnamed(3888), unnamed(2888))}, "", 2888, []string{"zk-0:2888", "zk-1:2888"}},
+		{"named and unnamed ports by number", []core.EndpointSubset{subset(0, named("client", 2181), unnamed(2888))}, "", 2888, []string{"zk-0:2888"}},
+		{"named and unnamed ports by name", []core.EndpointSubset{subset(0, unnamed(2888), named("client", 2181))}, "client", 0, []string{"zk-0:2181"}},
+		{"named and unnamed ports by both", []core.EndpointSubset{subset(0, named("client", 2181), unnamed(2181)), subset(1, unnamed(2181))}, "client", 2181, []string{"zk-0:2181"}},
+		{"name and number mismatch", []core.EndpointSubset{subset(0, named("client", 2181), unnamed(2888))}, "client", 2888, []string{}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got := []string{}
+			for _, ss := range FilterSubsets(c.subsets, c.portName, c.portNumber) {
+				if len(ss.Ports) != 1 {
+					t.Fatalf("FilterSubsets() ports = %v, want the matching one only", ss.Ports)
+				}
+				for _, address := range ss.Addresses {
+					got = append(got, address.Hostname+":"+strconv.Itoa(int(ss.Ports[0].Port)))
+				}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("FilterSubsets() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPollPortNumber(t *testing.T) {
+	// the pods only expose unnamed ports, told apart by their number
+	endpoints := testEndpoints([]int{0, 1}, nil)
+	endpoints.Subsets[0].Ports = []core.EndpointPort{{Port: 2181, Protocol: core.ProtocolTCP}, {Port: 2888, Protocol: core.ProtocolTCP}}
+	d := NewDiscoverer(fake.NewSimpleClientset(endpoints))
+	opts := testOptions(2)
+	opts.PortNumber = 2888
+	result := d.Poll(context.Background(), opts)
+	if !result.Met {
+		t.Fatalf("Poll() = %+v, want the count met", result)
+	}
+	for _, endpoint := range result.Endpoints {
+		if endpoint.Port != 2888 || len(endpoint.Ports) != 1 {
+			t.Errorf("Poll() endpoint %s ports = %d %v, want 2888 only", endpoint.Hostname, endpoint.Port, endpoint.Ports)
+		}
+	}
+	opts.PortNumber = 3888
+	if result := d.Poll(context.Background(), opts); result.Met || len(result.Endpoints) != 0 {
+		t.Errorf("Poll() of a port no pod exposes = %v, want no endpoints", Names(result.Endpoints))
+	}
+}
+
+func TestHostnameDefaultSources(t *testing.T) {
+	d := NewDiscoverer(fake.NewSimpleClientset())
+	// cached, so that no reverse lookup is made
+	d.lookups.names["10.0.0.5"] = "web-5.example.com"
+	d.lookups.names["10.0.0.6"] = ""
+	service := ServiceRef{Namespace: "default", Name: "web"}
+	opts := Options{Domain: "cluster.local"}
+	cases := []struct {
+		address                core.EndpointAddress
+		wantHostname, wantFQDN string
+	}{
+		{testAddress(0), "zk-0", "zk-0.web.default.svc.cluster.local"},
+		{core.EndpointAddress{IP: "10.0.0.1", TargetRef: &core.ObjectReference{Kind: "Pod", Name: "web-1"}}, "web-1", "web-1.web.default.svc.cluster.local"},
+		{core.EndpointAddress{IP: "10.0.0.5"}, "web-5", "web-5.example.com"},
+		{core.EndpointAddress{IP: "10.0.0.6"}, "", "10.0.0.6"},
+	}
+	for _, c := range cases {
+		hostname, fqdn := d.hostname(context.Background(), opts, service, c.address)
+		if hostname != c.wantHostname || fqdn != c.wantFQDN {
+			t.Errorf("hostname(%s) = %q %q, want %q %q", c.address.IP, hostname, fqdn, c.wantHostname, c.wantFQDN)
+		}
+	}
+}
+
+func TestCacheListsServices(t *testing.T) {
+	service := &core.Service{ObjectMeta: metav1.ObjectMeta{Name: "zk-hs", Namespace: "default"}}
+	other := &core.Service{ObjectMeta: metav1.ObjectMeta{Name: "kafka-hs", Namespace: "default"}}
+	clientset := fake.NewSimpleClientset(service, other, testEndpoints([]int{0, 1}, nil))
+	d := NewDiscoverer(clientset)
+	opts := testOptions(2)
+	opts.Service, opts.ServiceRegex = "", regexp.MustCompile("^zk-")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := d.StartCache(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+	for poll := 0; poll < 2; poll++ {
+		if result := d.Poll(ctx, opts); !result.Met || len(result.Endpoints) != 2 {
+			t.Fatalf("Poll() = %v, want the 2 endpoints of zk-hs", Names(result.Endpoints))
+		}
+	}
+	lists := 0
+	for _, action := range clientset.Actions() {
+		if action.Matches("list", "services") {
+			lists++
+		}
+	}
+	// the list of the informer, the polls reading the cache
+	if lists != 1 {
+		t.Errorf("%d lists of the services, want 1", lists)
+	}
+}
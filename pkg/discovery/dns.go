@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// getDNSEndpoints builds the endpoints object of a headless service from its DNS records: the SRV
+// records of the named port when opts.PortName is set, the A records of the service otherwise.
+// A service without records has no endpoints yet rather than failing.
+func getDNSEndpoints(ctx context.Context, opts Options, namespaceName string, serviceName string) (*core.Endpoints, error) {
+	serviceDomain := dnsServiceDomain(opts, namespaceName, serviceName)
+	endpoints := &core.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: serviceName, Namespace: namespaceName},
+	}
+	if opts.PortName != "" {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, opts.PortName, "tcp", serviceDomain)
+		if isDNSNotFound(err) {
+			return endpoints, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].Target < records[j].Target })
+		for _, record := range records {
+			target := strings.TrimSuffix(record.Target, ".")
+			ips, err := net.DefaultResolver.LookupHost(ctx, target)
+			if isDNSNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			subset := core.EndpointSubset{
+				Ports: []core.EndpointPort{{Name: opts.PortName, Port: int32(record.Port), Protocol: core.ProtocolTCP}},
+			}
+			for _, ip := range ips {
+				subset.Addresses = append(subset.Addresses, core.EndpointAddress{IP: ip, Hostname: dnsHostname(target, serviceDomain, ip)})
+			}
+			endpoints.Subsets = append(endpoints.Subsets, subset)
+		}
+		return endpoints, nil
+	}
+	ips, err := net.DefaultResolver.LookupHost(ctx, serviceDomain)
+	if isDNSNotFound(err) {
+		return endpoints, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ips)
+	subset := core.EndpointSubset{}
+	if opts.PortNumber != 0 {
+		subset.Ports = []core.EndpointPort{{Port: opts.PortNumber, Protocol: core.ProtocolTCP}}
+	}
+	for _, ip := range ips {
+		address := core.EndpointAddress{IP: ip}
+		// the PTR records of the pod give its hostname when it has one
+		names, _ := net.DefaultResolver.LookupAddr(ctx, ip)
+		for _, name := range names {
+			if address.Hostname = dnsHostname(strings.TrimSuffix(name, "."), serviceDomain, ip); address.Hostname != "" {
+				break
+			}
+		}
+		subset.Addresses = append(subset.Addresses, address)
+	}
+	endpoints.Subsets = append(endpoints.Subsets, subset)
+	return endpoints, nil
+}
+
+// dnsServiceDomain returns the <service>.<namespace>.svc.<domain> name of the service
+func dnsServiceDomain(opts Options, namespaceName string, serviceName string) string {
+	domain := opts.Domain
+	if domain == "" {
+		domain = "cluster.local"
+	}
+	return serviceName + "." + namespaceName + ".svc." + domain
+}
+
+// dnsHostname returns the hostname of a <hostname>.<service domain> name, or an empty string when
+// the name isn't of the service or is the dashed IP given to the addresses without a hostname
+func dnsHostname(name string, serviceDomain string, ip string) string {
+	hostname := strings.TrimSuffix(name, "."+serviceDomain)
+	if hostname == name || strings.Contains(hostname, ".") || hostname == strings.NewReplacer(".", "-", ":", "-").Replace(ip) {
+		return ""
+	}
+	return hostname
+}
+
+// isDNSNotFound reports whether the lookup failed because the name has no records
+func isDNSNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && dnsErr.IsNotFound
+}
@@ -0,0 +1,124 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// the TTL of the records is looked up with a query of its own, the Go resolver doesn't expose it
+const dnsQueryTimeout = 2 * time.Second
+
+// dnsWait returns the delay until the records of the services are re-resolved: the lowest TTL of
+// their SRV or A records with DNSTTL, at least a second, or the interval when the TTL can't be
+// determined
+func (d *Discoverer) dnsWait(ctx context.Context, opts Options) time.Duration {
+	if !opts.DNSTTL {
+		return waitInterval(opts)
+	}
+	server := getResolvConfNameserver("/etc/resolv.conf")
+	if server == "" {
+		log.Debug("No nameserver in /etc/resolv.conf, re-resolving every interval")
+		return waitInterval(opts)
+	}
+	var ttl time.Duration
+	for _, ref := range d.resolveServices(ctx, opts) {
+		name, qtype := dnsServiceDomain(opts, ref.Namespace, ref.Name), dnsmessage.TypeA
+		if opts.PortName != "" {
+			name, qtype = "_"+opts.PortName+"._tcp."+name, dnsmessage.TypeSRV
+		}
+		recordTTL, err := queryTTL(ctx, server, name, qtype)
+		if err != nil {
+			log.Debug("Unable to determine the TTL, re-resolving every interval", "name", name, "error", err)
+			return waitInterval(opts)
+		}
+		if ttl == 0 || recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+	if ttl < time.Second {
+		return waitInterval(opts)
+	}
+	log.Debug("Re-resolving once the records expire", "ttl", ttl)
+	return ttl
+}
+
+// queryTTL queries the server over UDP for the records of the name and returns their lowest TTL
+func queryTTL(ctx context.Context, server string, name string, qtype dnsmessage.Type) (time.Duration, error) {
+	question, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return 0, err
+	}
+	id := uint16(rand.Intn(1 << 16))
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: question, Type: qtype, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dnsQueryTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		var response dnsmessage.Message
+		if err := response.Unpack(buf[:n]); err != nil || response.ID != id {
+			// not the answer to the query
+			continue
+		}
+		if response.RCode != dnsmessage.RCodeSuccess {
+			return 0, errors.New(response.RCode.String())
+		}
+		var ttl uint32
+		found := false
+		for _, answer := range response.Answers {
+			if answer.Header.Type == qtype && (!found || answer.Header.TTL < ttl) {
+				ttl, found = answer.Header.TTL, true
+			}
+		}
+		if !found {
+			return 0, errors.New("no records")
+		}
+		return time.Duration(ttl) * time.Second, nil
+	}
+}
+
+// getResolvConfNameserver returns the host:port of the first nameserver of the resolv.conf
+func getResolvConfNameserver(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+	return ""
+}
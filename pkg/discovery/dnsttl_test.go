@@ -0,0 +1,97 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNS answers the queries on a local UDP port with the SRV records of the TTLs, or NXDOMAIN
+// without them, and returns its address
+func serveDNS(t *testing.T, ttls ...uint32) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			response := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true},
+				Questions: query.Questions,
+			}
+			if len(ttls) == 0 {
+				response.RCode = dnsmessage.RCodeNameError
+			}
+			for i, ttl := range ttls {
+				target := dnsmessage.MustNewName("zk-" + string(rune('0'+i)) + ".zk-hs.default.svc.cluster.local.")
+				response.Answers = append(response.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: ttl},
+					Body:   &dnsmessage.SRVResource{Port: 2181, Target: target},
+				})
+			}
+			packed, _ := response.Pack()
+			conn.WriteTo(packed, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestQueryTTL(t *testing.T) {
+	server := serveDNS(t, 30, 5, 60)
+	ttl, err := queryTTL(context.Background(), server, "_client._tcp.zk-hs.default.svc.cluster.local", dnsmessage.TypeSRV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the records expire with the first of them
+	if ttl != 5*time.Second {
+		t.Errorf("queryTTL() = %v, want 5s", ttl)
+	}
+	// the answers don't hold A records
+	if _, err := queryTTL(context.Background(), server, "zk-hs.default.svc.cluster.local", dnsmessage.TypeA); err == nil {
+		t.Error("queryTTL() of the missing records should fail")
+	}
+}
+
+func TestQueryTTLNotFound(t *testing.T) {
+	server := serveDNS(t)
+	if _, err := queryTTL(context.Background(), server, "_client._tcp.zk-hs.default.svc.cluster.local", dnsmessage.TypeSRV); err == nil {
+		t.Error("queryTTL() of NXDOMAIN should fail")
+	}
+}
+
+func TestGetResolvConfNameserver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	conf := "search default.svc.cluster.local svc.cluster.local cluster.local\nnameserver 10.96.0.10\nnameserver 10.96.0.11\noptions ndots:5\n"
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := getResolvConfNameserver(path); got != "10.96.0.10:53" {
+		t.Errorf("getResolvConfNameserver() = %q, want 10.96.0.10:53", got)
+	}
+	if got := getResolvConfNameserver(filepath.Join(t.TempDir(), "missing")); got != "" {
+		t.Errorf("getResolvConfNameserver() of a missing file = %q, want empty", got)
+	}
+}
+
+func TestDNSWaitFallsBackToInterval(t *testing.T) {
+	d := &Discoverer{}
+	opts := Options{Namespace: "default", Service: "zk-hs", Backend: BackendDNS, Interval: 3 * time.Second}
+	if got := d.dnsWait(context.Background(), opts); got != 3*time.Second {
+		t.Errorf("dnsWait() without DNSTTL = %v, want the interval", got)
+	}
+}
@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DiscoverDomain detects the cluster domain from the CoreDNS Corefile or the resolv.conf search
+// domains, falling back to the configured domain and finally to cluster.local
+func DiscoverDomain(ctx context.Context, clientset kubernetes.Interface, configured string) string {
+	if domain, err := getCoreDNSDomain(ctx, clientset); err != nil {
+		log.Warningf("Unable to read the CoreDNS configuration: %v", err)
+	} else if domain != "" {
+		log.Infof("Detected cluster domain %s from the CoreDNS configuration", domain)
+		return domain
+	}
+	if domain := getResolvConfDomain("/etc/resolv.conf"); domain != "" {
+		log.Infof("Detected cluster domain %s from /etc/resolv.conf", domain)
+		return domain
+	}
+	if configured != "" {
+		return configured
+	}
+	log.Warningf("Unable to detect the cluster domain, using cluster.local")
+	return "cluster.local"
+}
+
+// serviceAccountNamespace is the file the namespace of the pod is mounted to
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// DefaultNamespace returns the namespace of the pod read from its service account, or an empty
+// string when running outside of a cluster
+func DefaultNamespace() string {
+	data, err := ioutil.ReadFile(serviceAccountNamespace)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// DefaultDomain returns the cluster domain derived from the resolv.conf search domains, or an
+// empty string when they don't include one
+func DefaultDomain() string {
+	return getResolvConfDomain("/etc/resolv.conf")
+}
+
+// getCoreDNSDomain reads the zone of the kubernetes plugin from the coredns ConfigMap
+func getCoreDNSDomain(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, "coredns", metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(configMap.Data["Corefile"], "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[0] == "kubernetes" && fields[1] != "{" {
+			return strings.TrimSuffix(fields[1], "."), nil
+		}
+	}
+	return "", nil
+}
+
+// getResolvConfDomain derives the cluster domain from a svc.<domain> search entry
+func getResolvConfDomain(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "search" {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			if strings.HasPrefix(domain, "svc.") {
+				return strings.TrimSuffix(strings.TrimPrefix(domain, "svc."), ".")
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// zonesAnnotation holds the zones of the EndpointSlice endpoints by IP, as a JSON object, on the
+// Endpoints object they're converted into, the Endpoints addresses having no zone
+const zonesAnnotation = "endpoint-discovery.io/zones"
+
+// endpointSliceGroupVersion is the EndpointSlice API served by the cluster and supported by the client
+const endpointSliceGroupVersion = "discovery.k8s.io/v1"
+
+// ResolveBackend picks the API used to read endpoints, detecting EndpointSlice support in auto mode
+func ResolveBackend(clientset kubernetes.Interface, backend string) string {
+	if backend == "" {
+		return BackendEndpoints
+	}
+	if backend != BackendAuto {
+		return backend
+	}
+	if _, err := clientset.Discovery().ServerResourcesForGroupVersion(endpointSliceGroupVersion); err != nil {
+		log.Infof("EndpointSlices are not available (%v), using Endpoints", err)
+		return BackendEndpoints
+	}
+	log.Infof("Using %s EndpointSlices", endpointSliceGroupVersion)
+	return BackendEndpointSlices
+}
+
+// getEndpointSlices lists all EndpointSlices of the service, following List continuation tokens
+func getEndpointSlices(ctx context.Context, clientset kubernetes.Interface, namespaceName string, serviceName string, pageSize int64) ([]*discoveryv1.EndpointSlice, error) {
+	slices := []*discoveryv1.EndpointSlice{}
+	options := metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + serviceName,
+		Limit:         pageSize,
+	}
+	for {
+		list, err := clientset.DiscoveryV1().EndpointSlices(namespaceName).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			slices = append(slices, &list.Items[i])
+		}
+		if list.Continue == "" {
+			return slices, nil
+		}
+		options.Continue = list.Continue
+	}
+}
+
+// slicesToEndpoints converts the EndpointSlices of a service into an equivalent Endpoints object,
+// one subset per slice, so that the rest of the pipeline handles both APIs the same way. The
+// object takes the UID of the Service owning the slices, which changes when it's recreated, and
+// the zones of the endpoints in the zonesAnnotation.
+func slicesToEndpoints(namespaceName string, serviceName string, slices []*discoveryv1.EndpointSlice) *core.Endpoints {
+	endpoints := &core.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: serviceName, Namespace: namespaceName},
+		Subsets:    make([]core.EndpointSubset, 0, len(slices)),
+	}
+	zones := map[string]string{}
+	for _, slice := range slices {
+		for _, owner := range slice.OwnerReferences {
+			if owner.Kind == "Service" && owner.Name == serviceName {
+				endpoints.UID = owner.UID
+			}
+		}
+		if slice.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
+		}
+		subset := core.EndpointSubset{Addresses: make([]core.EndpointAddress, 0, len(slice.Endpoints))}
+		for _, port := range slice.Ports {
+			endpointPort := core.EndpointPort{}
+			if port.Name != nil {
+				endpointPort.Name = *port.Name
+			}
+			if port.Port != nil {
+				endpointPort.Port = *port.Port
+			}
+			if port.Protocol != nil {
+				endpointPort.Protocol = *port.Protocol
+			}
+			subset.Ports = append(subset.Ports, endpointPort)
+		}
+		for _, endpoint := range slice.Endpoints {
+			for _, ip := range endpoint.Addresses {
+				address := core.EndpointAddress{IP: ip, TargetRef: endpoint.TargetRef}
+				if endpoint.Hostname != nil {
+					address.Hostname = *endpoint.Hostname
+				}
+				address.NodeName = endpoint.NodeName
+				if endpoint.Zone != nil && *endpoint.Zone != "" {
+					zones[ip] = *endpoint.Zone
+				}
+				// a nil ready condition means ready
+				if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+					subset.Addresses = append(subset.Addresses, address)
+				} else {
+					subset.NotReadyAddresses = append(subset.NotReadyAddresses, address)
+				}
+			}
+		}
+		endpoints.Subsets = append(endpoints.Subsets, subset)
+	}
+	if len(zones) > 0 {
+		data, _ := json.Marshal(zones)
+		endpoints.Annotations = map[string]string{zonesAnnotation: string(data)}
+	}
+	return endpoints
+}
+
+// sliceZones returns the zones of the endpoints by IP recorded by slicesToEndpoints
+func sliceZones(endpoints *core.Endpoints) map[string]string {
+	zones := map[string]string{}
+	if value := endpoints.Annotations[zonesAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &zones); err != nil {
+			log.Debug("Invalid zones annotation", "endpoints", endpoints.Name, "error", err)
+		}
+	}
+	return zones
+}
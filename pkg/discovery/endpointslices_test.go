@@ -0,0 +1,202 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// testSlice returns an EndpointSlice of zk-hs with a ready endpoint per ordinal
+func testSlice(name string, ordinals ...int) discoveryv1.EndpointSlice {
+	port, portName := int32(2181), "client"
+	slice := discoveryv1.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{discoveryv1.LabelServiceName: "zk-hs"}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+	}
+	for _, ordinal := range ordinals {
+		hostname := fmt.Sprintf("zk-%d", ordinal)
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses: []string{fmt.Sprintf("10.0.0.%d", ordinal)},
+			Hostname:  &hostname,
+		})
+	}
+	return slice
+}
+
+// pagedLists makes the clientset answer the lists of the resource with the pages in turn,
+// every page but the last with a continue token, and returns the number of lists made
+func pagedLists(clientset *fake.Clientset, resource string, pages []runtime.Object) *int {
+	calls := 0
+	clientset.PrependReactor("list", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if calls >= len(pages) {
+			return true, nil, fmt.Errorf("list %d past the last page", calls)
+		}
+		page := pages[calls].DeepCopyObject()
+		calls++
+		if calls < len(pages) {
+			page.(metav1.ListInterface).SetContinue(fmt.Sprintf("page-%d", calls))
+		}
+		return true, page, nil
+	})
+	return &calls
+}
+
+func expectUniqueNames(t *testing.T, endpoints []Endpoint, count int) {
+	t.Helper()
+	names := Names(endpoints)
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("%s is listed twice in %v", name, names)
+		}
+		seen[name] = true
+	}
+	want := []string{}
+	for i := 0; i < count; i++ {
+		want = append(want, fmt.Sprintf("zk-%d.zk-hs.default.svc.cluster.local", i))
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
+
+func TestEndpointSlicesPagination(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	calls := pagedLists(clientset, "endpointslices", []runtime.Object{
+		&discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{testSlice("a", 0, 1), testSlice("b", 2)}},
+		&discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{testSlice("c", 3, 4)}},
+		&discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{testSlice("d", 5)}},
+	})
+	opts := testOptions(6)
+	opts.Backend, opts.PageSize = BackendEndpointSlices, 2
+	result := NewDiscoverer(clientset).Poll(context.Background(), opts)
+	if result.Err != nil || !result.Met {
+		t.Fatalf("Poll() = %v met %v, want the 6 endpoints of the 3 pages", result.Err, result.Met)
+	}
+	if *calls != 3 {
+		t.Errorf("%d lists, want one per page", *calls)
+	}
+	expectUniqueNames(t, result.Endpoints, 6)
+}
+
+func TestPodSelectorPagination(t *testing.T) {
+	pod := func(ordinal int) core.Pod {
+		return core.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("zk-%d", ordinal), Namespace: "default", Labels: map[string]string{"app": "zk"}},
+			Status: core.PodStatus{
+				PodIP:      fmt.Sprintf("10.0.0.%d", ordinal),
+				Conditions: []core.PodCondition{{Type: core.PodReady, Status: core.ConditionTrue}},
+			},
+		}
+	}
+	clientset := fake.NewSimpleClientset()
+	calls := pagedLists(clientset, "pods", []runtime.Object{
+		&core.PodList{Items: []core.Pod{pod(0), pod(1)}},
+		&core.PodList{Items: []core.Pod{pod(2), pod(3)}},
+	})
+	opts := testOptions(4)
+	opts.PodSelector, opts.PageSize = labels.SelectorFromSet(labels.Set{"app": "zk"}), 2
+	result := NewDiscoverer(clientset).Poll(context.Background(), opts)
+	if result.Err != nil || !result.Met {
+		t.Fatalf("Poll() = %v met %v, want the 4 pods of the 2 pages", result.Err, result.Met)
+	}
+	if *calls != 2 {
+		t.Errorf("%d lists, want one per page", *calls)
+	}
+	expectUniqueNames(t, result.Endpoints, 4)
+}
+
+func TestEndpointSlicesDualStack(t *testing.T) {
+	// the IPv6 slice is listed first, zk-2 only has an IPv4 address and zk-3 no target pod
+	ipv4 := testSlice("zk-hs-ipv4", 0, 1, 2, 3)
+	ipv6 := testSlice("zk-hs-ipv6", 0, 1, 3)
+	ipv6.AddressType = discoveryv1.AddressTypeIPv6
+	for i := range ipv6.Endpoints {
+		ipv6.Endpoints[i].Addresses = []string{"fd00::" + strings.TrimPrefix(ipv6.Endpoints[i].Addresses[0], "10.0.0.")}
+	}
+	for _, slice := range []*discoveryv1.EndpointSlice{&ipv4, &ipv6} {
+		for i := range slice.Endpoints[:len(slice.Endpoints)-1] {
+			name := *slice.Endpoints[i].Hostname
+			slice.Endpoints[i].TargetRef = &core.ObjectReference{Kind: "Pod", Namespace: "default", Name: name}
+		}
+	}
+	d := NewDiscoverer(fake.NewSimpleClientset(&ipv6, &ipv4))
+	for _, c := range []struct {
+		name string
+		opts func(*Options)
+		ips  [][]string
+		fqdn string
+	}{
+		{"dual", func(o *Options) {}, [][]string{{"10.0.0.0", "fd00::0"}, {"10.0.0.1", "fd00::1"}, {"10.0.0.2"}, {"10.0.0.3", "fd00::3"}}, "zk-0.zk-hs.default.svc.cluster.local"},
+		{"dual ip", func(o *Options) { o.AddressType = "ip" }, [][]string{{"10.0.0.0", "fd00::0"}, {"10.0.0.1", "fd00::1"}, {"10.0.0.2"}, {"10.0.0.3", "fd00::3"}}, "10.0.0.0"},
+		{"ipv6", func(o *Options) { o.AddressFamily = "ipv6" }, [][]string{{"fd00::0"}, {"fd00::1"}, {"fd00::3"}}, "zk-0.zk-hs.default.svc.cluster.local"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			opts := testOptions(len(c.ips))
+			opts.Backend = BackendEndpointSlices
+			c.opts(&opts)
+			result := d.Poll(context.Background(), opts)
+			if !result.Met {
+				t.Errorf("Poll() found %d endpoints, want the count of %d pods met", len(result.Endpoints), len(c.ips))
+			}
+			ips := [][]string{}
+			for _, endpoint := range result.Endpoints {
+				if endpoint.IP != endpoint.IPs[0] {
+					t.Errorf("Poll() endpoint %s IP = %s, want the first of %v", endpoint.FQDN, endpoint.IP, endpoint.IPs)
+				}
+				ips = append(ips, endpoint.IPs)
+			}
+			if !reflect.DeepEqual(ips, c.ips) {
+				t.Errorf("Poll() IPs = %v, want %v", ips, c.ips)
+			}
+			if result.Endpoints[0].FQDN != c.fqdn {
+				t.Errorf("Poll() first name = %s, want %s", result.Endpoints[0].FQDN, c.fqdn)
+			}
+		})
+	}
+}
+
+func TestEndpointSlicesZones(t *testing.T) {
+	slice := testSlice("zk-hs-abcde", 0, 1, 2)
+	zone, node := "us-east-1a", "node-a"
+	slice.Endpoints[0].Zone, slice.Endpoints[0].NodeName = &zone, &node
+	// zk-1 has a node but no zone, zk-2 neither
+	slice.Endpoints[1].NodeName = &node
+	clientset := fake.NewSimpleClientset(&slice)
+	gets := 0
+	clientset.PrependReactor("get", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return true, nil, fmt.Errorf("nodes is forbidden")
+	})
+	d := NewDiscoverer(clientset)
+	opts := testOptions(3)
+	opts.Backend = BackendEndpointSlices
+	result := d.Poll(context.Background(), opts)
+	if !result.Met {
+		t.Fatalf("Poll() = %+v, want the count met", result)
+	}
+	zones := map[string]string{}
+	for _, endpoint := range result.Endpoints {
+		zones[endpoint.Hostname] = d.EndpointZone(context.Background(), endpoint)
+	}
+	want := map[string]string{"zk-0": "us-east-1a", "zk-1": "unknown", "zk-2": "unknown"}
+	if !reflect.DeepEqual(zones, want) {
+		t.Errorf("EndpointZone() = %v, want %v", zones, want)
+	}
+	if gets != 1 {
+		t.Errorf("%d node lookups, want only the one of zk-1", gets)
+	}
+}
@@ -0,0 +1,45 @@
+package discovery
+
+import (
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// IsPermanent reports whether the API error won't go away by retrying the same request: the
+// request is denied or rejected as invalid. The missing services, timeouts, throttling and
+// unreachable servers are transient.
+func IsPermanent(err error) bool {
+	return errors.IsForbidden(err) || errors.IsUnauthorized(err) || errors.IsBadRequest(err) ||
+		errors.IsInvalid(err) || errors.IsMethodNotSupported(err) || errors.IsNotAcceptable(err) ||
+		errors.IsUnsupportedMediaType(err)
+}
+
+// logReadError logs the failure to read from the API at the level of its category: a service
+// not created yet is expected while a cluster is deployed, a denied or rejected request needs
+// fixing, and the other errors are retried. The key-value attributes identify what was read.
+func logReadError(what string, err error, attrs ...interface{}) {
+	attrs = append(attrs, "error", err)
+	switch {
+	case errors.IsNotFound(err):
+		log.Info("Unable to "+what+", not created yet", attrs...)
+	case errors.IsForbidden(err) || errors.IsUnauthorized(err):
+		log.Error("Unable to "+what+", permission denied", attrs...)
+	case IsPermanent(err):
+		log.Error("Unable to "+what+", request rejected", attrs...)
+	case errors.IsTimeout(err) || errors.IsServerTimeout(err) || errors.IsTooManyRequests(err):
+		log.Warn("Unable to "+what+", API server busy, retrying", attrs...)
+	default:
+		log.Warn("Unable to "+what+", retrying", attrs...)
+	}
+}
+
+// retryDelay returns the delay before retrying after the error, at least the one the API server
+// asked for when throttling
+func retryDelay(err error, delay time.Duration) time.Duration {
+	if seconds, ok := errors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > delay {
+		return time.Duration(seconds) * time.Second
+	}
+	return delay
+}
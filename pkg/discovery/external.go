@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"context"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// externalAnnotation marks the endpoints objects built from a Service rather than read from the
+// API, whose address hostnames are external DNS names instead of pod hostnames
+const externalAnnotation = "endpoint-discovery.io/external"
+
+// getServiceEndpoints builds the endpoints object of the service from the Service itself: its
+// external name for an ExternalName service, the ingress points of its load balancer otherwise.
+// A load balancer not provisioned yet has no endpoints.
+func (d *Discoverer) getServiceEndpoints(ctx context.Context, namespaceName string, serviceName string) (*core.Endpoints, error) {
+	service, err := d.clientset.CoreV1().Services(namespaceName).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return serviceToEndpoints(service, true), nil
+}
+
+// getExternalName returns the endpoints object of an ExternalName service whose Endpoints or
+// EndpointSlices were missing, or nil when the service isn't of that type
+func (d *Discoverer) getExternalName(ctx context.Context, namespaceName string, serviceName string) *core.Endpoints {
+	service, err := d.clientset.CoreV1().Services(namespaceName).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil || service.Spec.Type != core.ServiceTypeExternalName {
+		return nil
+	}
+	return serviceToEndpoints(service, false)
+}
+
+// isMissing reports whether the service has no Endpoints, or no EndpointSlices with that backend,
+// which is the case of ExternalName services
+func isMissing(backend string, endpoints *core.Endpoints, err error) bool {
+	if backend == BackendEndpointSlices {
+		return err == nil && len(endpoints.Subsets) == 0
+	}
+	return errors.IsNotFound(err)
+}
+
+// serviceToEndpoints converts the external name of an ExternalName service, or the load balancer
+// ingress points of the service when loadBalancer is set, into an endpoints object with the
+// ports of the service
+func serviceToEndpoints(service *core.Service, loadBalancer bool) *core.Endpoints {
+	endpoints := &core.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        service.Name,
+			Namespace:   service.Namespace,
+			Annotations: map[string]string{externalAnnotation: "true"},
+		},
+	}
+	subset := core.EndpointSubset{}
+	for _, port := range service.Spec.Ports {
+		subset.Ports = append(subset.Ports, core.EndpointPort{Name: port.Name, Port: port.Port, Protocol: port.Protocol})
+	}
+	switch {
+	case service.Spec.Type == core.ServiceTypeExternalName:
+		subset.Addresses = append(subset.Addresses, core.EndpointAddress{Hostname: service.Spec.ExternalName})
+	case loadBalancer:
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			subset.Addresses = append(subset.Addresses, core.EndpointAddress{IP: ingress.IP, Hostname: ingress.Hostname})
+		}
+	}
+	if len(subset.Addresses) > 0 {
+		endpoints.Subsets = append(endpoints.Subsets, subset)
+	}
+	return endpoints
+}
+
+// externalName returns the name emitted for an external address: its DNS name, or its IP when it
+// has none or IPs are requested and it has one
+func externalName(address core.EndpointAddress, addressType string) string {
+	if address.Hostname == "" || (addressType == "ip" && address.IP != "") {
+		return address.IP
+	}
+	return address.Hostname
+}
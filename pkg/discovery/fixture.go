@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	core "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// NewFixtureDiscoverer creates a Discoverer reading the endpoints of the services from the
+// objects instead of the Kubernetes API, e.g. to test formats and templates without a cluster.
+// A service without an object isn't found.
+func NewFixtureDiscoverer(objects []*core.Endpoints) *Discoverer {
+	d := NewDiscoverer(nil)
+	d.fixture = map[ServiceRef]*core.Endpoints{}
+	for _, endpoints := range objects {
+		d.fixture[ServiceRef{Namespace: endpoints.Namespace, Name: endpoints.Name}] = endpoints
+	}
+	return d
+}
+
+// getFixture returns the endpoints object of the service from the fixture
+func (d *Discoverer) getFixture(namespaceName string, serviceName string) (*core.Endpoints, error) {
+	endpoints, ok := d.fixture[ServiceRef{Namespace: namespaceName, Name: serviceName}]
+	if !ok {
+		return nil, errors.NewNotFound(core.Resource("endpoints"), serviceName)
+	}
+	return endpoints, nil
+}
+
+// ReadManifests parses YAML or JSON manifests of Endpoints, EndpointSlices or lists of them, in
+// one or several documents, into endpoints objects, the EndpointSlices of a service being merged
+// like the endpointslices backend does. Objects without a namespace are given namespaceName.
+func ReadManifests(r io.Reader, namespaceName string) ([]*core.Endpoints, error) {
+	objects := []*core.Endpoints{}
+	slices := map[ServiceRef][]*discoveryv1.EndpointSlice{}
+	services := []ServiceRef{}
+	var add func(object runtime.Object) error
+	add = func(object runtime.Object) error {
+		switch object := object.(type) {
+		case *core.Endpoints:
+			if object.Namespace == "" {
+				object.Namespace = namespaceName
+			}
+			objects = append(objects, object)
+		case *core.EndpointsList:
+			for i := range object.Items {
+				if err := add(&object.Items[i]); err != nil {
+					return err
+				}
+			}
+		case *discoveryv1.EndpointSlice:
+			service := ServiceRef{Namespace: object.Namespace, Name: object.Labels[discoveryv1.LabelServiceName]}
+			if service.Namespace == "" {
+				service.Namespace = namespaceName
+			}
+			if service.Name == "" {
+				return fmt.Errorf("EndpointSlice %s has no %s label", object.Name, discoveryv1.LabelServiceName)
+			}
+			if _, ok := slices[service]; !ok {
+				services = append(services, service)
+			}
+			slices[service] = append(slices[service], object)
+		case *discoveryv1.EndpointSliceList:
+			for i := range object.Items {
+				if err := add(&object.Items[i]); err != nil {
+					return err
+				}
+			}
+		case *core.List:
+			for _, item := range object.Items {
+				decoded, _, err := scheme.Codecs.UniversalDeserializer().Decode(item.Raw, nil, nil)
+				if err != nil {
+					return err
+				}
+				if err := add(decoded); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported object %s, expected Endpoints or EndpointSlices", object.GetObjectKind().GroupVersionKind().Kind)
+		}
+		return nil
+	}
+
+	reader := yaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		document, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(document)) == 0 {
+			continue
+		}
+		object, _, err := scheme.Codecs.UniversalDeserializer().Decode(document, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(object); err != nil {
+			return nil, err
+		}
+	}
+	for _, service := range services {
+		objects = append(objects, slicesToEndpoints(service.Namespace, service.Name, slices[service]))
+	}
+	return objects, nil
+}
@@ -0,0 +1,73 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+)
+
+// The sources of the hostname of an endpoint address
+const (
+	// HostnameFromAddress takes the hostname of the address, set for the pods of a StatefulSet
+	HostnameFromAddress = "hostname"
+	// HostnameFromPod takes the name of the target pod of the address. Its FQDN under the service
+	// domain doesn't resolve, the cluster DNS only naming the addresses with a hostname.
+	HostnameFromPod = "pod"
+	// HostnameFromDNS takes the reverse DNS name of the address IP as the FQDN
+	HostnameFromDNS = "dns"
+	// HostnameFromIP uses the IP itself as the FQDN, leaving the hostname empty
+	HostnameFromIP = "ip"
+)
+
+// DefaultHostnameSources is the fallback chain of the addresses without a hostname when
+// Options.HostnameSources is empty
+var DefaultHostnameSources = []string{HostnameFromAddress, HostnameFromPod, HostnameFromDNS, HostnameFromIP}
+
+// ParseHostnameSources parses a comma-separated fallback chain of hostname sources
+func ParseHostnameSources(value string) ([]string, error) {
+	sources := []string{}
+	for _, source := range strings.Split(value, ",") {
+		switch source = strings.TrimSpace(source); source {
+		case HostnameFromAddress, HostnameFromPod, HostnameFromDNS, HostnameFromIP:
+			sources = append(sources, source)
+		default:
+			return nil, fmt.Errorf("unknown source %q, must be hostname, pod, dns or ip", source)
+		}
+	}
+	return sources, nil
+}
+
+// hostname returns the hostname and the FQDN of the address from the first of the sources giving
+// one. An address none of them names keeps an empty hostname.
+func (d *Discoverer) hostname(ctx context.Context, opts Options, service ServiceRef, address core.EndpointAddress) (string, string) {
+	sources := opts.HostnameSources
+	if len(sources) == 0 {
+		sources = DefaultHostnameSources
+	}
+	for _, source := range sources {
+		switch source {
+		case HostnameFromAddress:
+			if address.Hostname != "" {
+				return address.Hostname, getFqdn(address.Hostname, service.Namespace, service.Name, opts.Domain)
+			}
+		case HostnameFromPod:
+			if address.TargetRef != nil && address.TargetRef.Kind == "Pod" && address.TargetRef.Name != "" {
+				return address.TargetRef.Name, getFqdn(address.TargetRef.Name, service.Namespace, service.Name, opts.Domain)
+			}
+		case HostnameFromDNS:
+			if address.IP == "" {
+				continue
+			}
+			if name := d.lookups.getReverseName(ctx, address.IP); name != "" {
+				return strings.SplitN(name, ".", 2)[0], name
+			}
+		case HostnameFromIP:
+			if address.IP != "" {
+				return "", address.IP
+			}
+		}
+	}
+	return address.Hostname, getFqdn(address.Hostname, service.Namespace, service.Name, opts.Domain)
+}
@@ -0,0 +1,140 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// reverseLookupTimeout bounds the reverse DNS lookup of an address IP
+const reverseLookupTimeout = 2 * time.Second
+
+// errNoCluster is returned by the lookups of a Discoverer without a clientset, e.g. reading a fixture
+var errNoCluster = errors.New("no cluster access")
+
+// lookupCache caches the pods and nodes referenced by endpoint addresses, and the reverse DNS
+// names of their IPs, for the duration of a run
+type lookupCache struct {
+	mu        sync.Mutex
+	clientset kubernetes.Interface
+	pods      map[string]*core.Pod
+	nodes     map[string]*core.Node
+	names     map[string]string
+	failed    map[string]bool
+}
+
+func newLookupCache(clientset kubernetes.Interface) *lookupCache {
+	return &lookupCache{
+		clientset: clientset,
+		pods:      map[string]*core.Pod{},
+		nodes:     map[string]*core.Node{},
+		names:     map[string]string{},
+		failed:    map[string]bool{},
+	}
+}
+
+// firstFailure records a failed lookup of the object, reporting whether it's the first one so
+// that it's only logged once
+func (c *lookupCache) firstFailure(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failed[key] {
+		return false
+	}
+	c.failed[key] = true
+	return true
+}
+
+// getTarget returns the pod an endpoint address points to, or nil when it doesn't reference a pod
+func (c *lookupCache) getTarget(ctx context.Context, address core.EndpointAddress) (*core.Pod, error) {
+	ref := address.TargetRef
+	if ref == nil || ref.Kind != "Pod" {
+		return nil, nil
+	}
+	key := ref.Namespace + "/" + ref.Name
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pod, ok := c.pods[key]; ok {
+		return pod, nil
+	}
+	if c.clientset == nil {
+		return nil, errNoCluster
+	}
+	pod, err := c.clientset.CoreV1().Pods(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	c.pods[key] = pod
+	return pod, nil
+}
+
+// getNode returns the named node, or nil when the name is empty
+func (c *lookupCache) getNode(ctx context.Context, name string) (*core.Node, error) {
+	if name == "" {
+		return nil, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if node, ok := c.nodes[name]; ok {
+		return node, nil
+	}
+	if c.clientset == nil {
+		return nil, errNoCluster
+	}
+	node, err := c.clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	c.nodes[name] = node
+	return node, nil
+}
+
+// getReverseName returns the first reverse DNS name of the IP without its trailing dot, or an
+// empty string when it has none. Failed lookups aren't retried.
+func (c *lookupCache) getReverseName(ctx context.Context, ip string) string {
+	c.mu.Lock()
+	name, ok := c.names[ip]
+	c.mu.Unlock()
+	if ok {
+		return name
+	}
+	// not holding the lock over the lookup, which would serialize the pod and node lookups too
+	ctx, cancel := context.WithTimeout(ctx, reverseLookupTimeout)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	} else {
+		log.Debug("No reverse DNS name", "ip", ip, "error", err)
+	}
+	c.mu.Lock()
+	c.names[ip] = name
+	c.mu.Unlock()
+	return name
+}
+
+// isMember reports whether the address target pod carries the annotation with the expected value
+func isMember(ctx context.Context, lookups *lookupCache, address core.EndpointAddress, annotation string, value string) bool {
+	pod, err := lookups.getTarget(ctx, address)
+	if err != nil {
+		log.Warningf("Excluding %s: unable to get the target pod: %v", address.IP, err)
+		return false
+	}
+	if pod == nil {
+		log.Infof("Excluding %s: the address doesn't reference a pod", address.IP)
+		return false
+	}
+	if actual, ok := pod.Annotations[annotation]; !ok || actual != value {
+		log.Infof("Excluding pod %s: annotation %s is not %q", pod.Name, annotation, value)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package discovery
+
+import (
+	"context"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// getPodEndpoints lists the pods matching opts.PodSelector, following List continuation tokens,
+// and builds the endpoints object of the service from them
+func getPodEndpoints(ctx context.Context, clientset kubernetes.Interface, opts Options, namespaceName string, serviceName string) (*core.Endpoints, error) {
+	pods := []*core.Pod{}
+	options := metav1.ListOptions{
+		LabelSelector: opts.PodSelector.String(),
+		Limit:         opts.PageSize,
+	}
+	for {
+		list, err := clientset.CoreV1().Pods(namespaceName).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			pods = append(pods, &list.Items[i])
+		}
+		if list.Continue == "" {
+			return podsToEndpoints(namespaceName, serviceName, pods), nil
+		}
+		options.Continue = list.Continue
+	}
+}
+
+// podsToEndpoints converts pods into the endpoints object a headless service selecting them
+// would have, one subset per pod with its container ports. The pods being deleted, terminated
+// or without an IP yet are left out, like the endpoints controller does.
+func podsToEndpoints(namespaceName string, serviceName string, pods []*core.Pod) *core.Endpoints {
+	endpoints := &core.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: serviceName, Namespace: namespaceName},
+		Subsets:    make([]core.EndpointSubset, 0, len(pods)),
+	}
+	for _, pod := range pods {
+		if pod.Status.PodIP == "" || pod.DeletionTimestamp != nil || pod.Status.Phase == core.PodSucceeded || pod.Status.Phase == core.PodFailed {
+			continue
+		}
+		address := core.EndpointAddress{
+			IP:        pod.Status.PodIP,
+			Hostname:  pod.Spec.Hostname,
+			TargetRef: &core.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID, ResourceVersion: pod.ResourceVersion},
+		}
+		// the StatefulSet pod names carry the ordinal
+		if address.Hostname == "" {
+			address.Hostname = pod.Name
+		}
+		if pod.Spec.NodeName != "" {
+			nodeName := pod.Spec.NodeName
+			address.NodeName = &nodeName
+		}
+		subset := core.EndpointSubset{}
+		for _, container := range pod.Spec.Containers {
+			for _, port := range container.Ports {
+				subset.Ports = append(subset.Ports, core.EndpointPort{Name: port.Name, Port: port.ContainerPort, Protocol: port.Protocol})
+			}
+		}
+		if isPodReady(pod) {
+			subset.Addresses = append(subset.Addresses, address)
+		} else {
+			subset.NotReadyAddresses = append(subset.NotReadyAddresses, address)
+		}
+		endpoints.Subsets = append(endpoints.Subsets, subset)
+	}
+	return endpoints
+}
+
+// isPodReady reports whether the Ready condition of the pod is true
+func isPodReady(pod *core.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == core.PodReady {
+			return condition.Status == core.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+const (
+	// probeConcurrency is the number of endpoints probed at the same time
+	probeConcurrency = 16
+	// probeAttempts is the number of dials before an endpoint is considered unreachable
+	probeAttempts   = 3
+	probeRetryDelay = 500 * time.Millisecond
+)
+
+// probeEndpoints returns the endpoints accepting TCP connections on opts.ProbePort, in order
+func probeEndpoints(ctx context.Context, opts Options, endpoints []Endpoint) []Endpoint {
+	timeout := opts.ProbeTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	reachable := make([]bool, len(endpoints))
+	slots := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for i := range endpoints {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			reachable[i] = probe(ctx, endpoints[i], opts.ProbePort, timeout)
+		}(i)
+	}
+	wg.Wait()
+	result := []Endpoint{}
+	for i, endpoint := range endpoints {
+		if reachable[i] {
+			result = append(result, endpoint)
+		}
+	}
+	return result
+}
+
+// probe dials the IP of the endpoint on the port, retrying a few times
+func probe(ctx context.Context, endpoint Endpoint, port int32, timeout time.Duration) bool {
+	address := net.JoinHostPort(endpoint.IP, strconv.Itoa(int(port)))
+	dialer := &net.Dialer{Timeout: timeout}
+	var err error
+	for attempt := 1; attempt <= probeAttempts; attempt++ {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", address); err == nil {
+			conn.Close()
+			return true
+		}
+		if attempt < probeAttempts {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(probeRetryDelay):
+			}
+		}
+	}
+	log.Info("Endpoint not reachable", "endpoint", endpoint.FQDN, "address", address, "error", err)
+	return false
+}
@@ -0,0 +1,55 @@
+package discovery
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"sort"
+)
+
+// sortService orders the endpoints of a single service so that the output doesn't depend on the
+// API order: by ordinal by default, the StatefulSet one unless the regex is set, by hostname, or by IP. Ties and endpoints without
+// an ordinal or hostname fall back to the next keys, the IP last. The none mode keeps the API order.
+func sortService(mode string, ordinalRegex *regexp.Regexp, endpoints []Endpoint) {
+	if mode == "none" {
+		return
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if mode != "hostname" && mode != "ip" {
+			if less, ok := ordinalLess(a, b, ordinalRegex); ok {
+				return less
+			}
+		}
+		if mode != "ip" && a.Hostname != b.Hostname {
+			return a.Hostname < b.Hostname
+		}
+		return compareIPs(a.IP, b.IP) < 0
+	})
+}
+
+// ordinalLess compares the ordinals of the hostnames, parsed with the regex or as StatefulSet
+// ordinals when nil, the endpoints without one coming last. It reports false when they don't
+// differ.
+func ordinalLess(a Endpoint, b Endpoint, ordinalRegex *regexp.Regexp) (bool, bool) {
+	oa, ob := ParseOrdinal(a.Hostname, ordinalRegex), ParseOrdinal(b.Hostname, ordinalRegex)
+	if oa == ob {
+		return false, false
+	}
+	return ob < 0 || (oa >= 0 && oa < ob), true
+}
+
+// compareIPs compares the addresses numerically, IPv4 before IPv6
+func compareIPs(a string, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return bytes.Compare([]byte(a), []byte(b))
+	}
+	if v4A, v4B := ipA.To4(), ipB.To4(); (v4A == nil) != (v4B == nil) {
+		if v4A != nil {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(ipA.To16(), ipB.To16())
+}
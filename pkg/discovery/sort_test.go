@@ -0,0 +1,123 @@
+package discovery
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func hostnames(endpoints []Endpoint) []string {
+	names := []string{}
+	for _, endpoint := range endpoints {
+		names = append(names, endpoint.Hostname)
+	}
+	return names
+}
+
+func testHosts(names ...string) []Endpoint {
+	endpoints := []Endpoint{}
+	for _, name := range names {
+		endpoints = append(endpoints, Endpoint{Hostname: name, FQDN: name + ".zk-hs.default.svc.cluster.local"})
+	}
+	return endpoints
+}
+
+func TestSortByWeight(t *testing.T) {
+	endpoints := testHosts("web-b", "zk-1", "web-a", "zk-0", "zk-2")
+	weights := map[string]float64{}
+	for _, endpoint := range endpoints {
+		weights[endpoint.FQDN] = 1
+	}
+	weights[endpoints[4].FQDN] = 5
+	sortByWeight(endpoints, weights, nil)
+	// the ties are ordered by ordinal, the endpoints without one last by name
+	want := []string{"zk-2", "zk-0", "zk-1", "web-a", "web-b"}
+	if got := hostnames(endpoints); !reflect.DeepEqual(got, want) {
+		t.Errorf("sortByWeight() = %v, want %v", got, want)
+	}
+}
+
+func TestSortServiceOrdinalRegex(t *testing.T) {
+	re := regexp.MustCompile(`^node(\d+)$`)
+	for _, c := range []struct {
+		name  string
+		mode  string
+		re    *regexp.Regexp
+		hosts []string
+		want  []string
+	}{
+		{"statefulset", "", nil, []string{"zk-10", "web", "zk-2"}, []string{"zk-2", "zk-10", "web"}},
+		{"regex", "ordinal", re, []string{"node10", "other", "node9"}, []string{"node9", "node10", "other"}},
+		{"hostname", "hostname", re, []string{"node10", "other", "node9"}, []string{"node10", "node9", "other"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			endpoints := testHosts(c.hosts...)
+			sortService(c.mode, c.re, endpoints)
+			if got := hostnames(endpoints); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("sortService() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSortWeightOrdinalRegex(t *testing.T) {
+	endpoints := testHosts("node10", "node9")
+	sortByWeight(endpoints, map[string]float64{}, regexp.MustCompile(`^node(\d+)$`))
+	if got, want := hostnames(endpoints), []string{"node9", "node10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortByWeight() = %v, want %v", got, want)
+	}
+}
+
+func TestSeenOrder(t *testing.T) {
+	o := newSeenOrder()
+	for _, c := range []struct {
+		name  string
+		poll  []string
+		prune bool
+		want  []string
+	}{
+		{"first poll", []string{"zk-1", "zk-2"}, true, []string{"zk-1", "zk-2"}},
+		{"new endpoint last", []string{"zk-0", "zk-1", "zk-2"}, true, []string{"zk-1", "zk-2", "zk-0"}},
+		{"gone endpoint forgotten", []string{"zk-0", "zk-2"}, true, []string{"zk-2", "zk-0"}},
+		{"returning endpoint last", []string{"zk-0", "zk-1", "zk-2"}, true, []string{"zk-2", "zk-0", "zk-1"}},
+		{"incomplete poll keeps the positions", []string{"zk-1"}, false, []string{"zk-1"}},
+		{"after an incomplete poll", []string{"zk-0", "zk-1", "zk-2"}, true, []string{"zk-2", "zk-0", "zk-1"}},
+	} {
+		endpoints := testHosts(c.poll...)
+		o.sort(endpoints, c.prune)
+		if got := hostnames(endpoints); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: sort() = %v, want %v", c.name, got, c.want)
+		}
+	}
+	if len(o.entries) != 3 {
+		t.Errorf("sort() remembers %d positions, want 3", len(o.entries))
+	}
+}
+
+func TestSeenOrderRecreated(t *testing.T) {
+	o := newSeenOrder()
+	observe := func(uid types.UID, podUIDs ...string) []string {
+		o.observeServices([]*core.Endpoints{{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "zk-hs", UID: uid}}})
+		endpoints := testHosts("zk-0", "zk-1", "zk-2")
+		for i := range endpoints {
+			endpoints[i].Namespace, endpoints[i].Service, endpoints[i].PodUID = "default", "zk-hs", podUIDs[i]
+		}
+		o.sort(endpoints, true)
+		return hostnames(endpoints)
+	}
+	if got, want := observe("service-1", "a", "b", "c"), []string{"zk-0", "zk-1", "zk-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sort() = %v, want %v", got, want)
+	}
+	// zk-0 was deleted and recreated by the StatefulSet between the polls
+	if got, want := observe("service-1", "d", "b", "c"), []string{"zk-1", "zk-2", "zk-0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sort() after a pod recreation = %v, want %v", got, want)
+	}
+	// the recreated service starts fresh, in ordinal order
+	if got, want := observe("service-2", "e", "f", "g"), []string{"zk-0", "zk-1", "zk-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sort() after a service recreation = %v, want %v", got, want)
+	}
+}
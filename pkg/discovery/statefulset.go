@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// StatefulSetReplicas returns the desired replica count of the StatefulSet referenced as
+// statefulset/<name>, or of the StatefulSet governing the service when the reference is "auto"
+func (d *Discoverer) StatefulSetReplicas(ctx context.Context, namespaceName string, serviceName string, reference string) (int, error) {
+	if reference == "auto" {
+		return d.getGoverningReplicas(ctx, namespaceName, serviceName)
+	}
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) != 2 || (parts[0] != "statefulset" && parts[0] != "sts") || parts[1] == "" {
+		return 0, fmt.Errorf("invalid reference %q: must be statefulset/<name> or auto", reference)
+	}
+	statefulSet, err := d.clientset.AppsV1().StatefulSets(namespaceName).Get(ctx, parts[1], metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return getReplicas(statefulSet.Spec.Replicas), nil
+}
+
+// getGoverningReplicas finds the StatefulSet whose serviceName is the service, or failing that
+// the one whose pods the service selects
+func (d *Discoverer) getGoverningReplicas(ctx context.Context, namespaceName string, serviceName string) (int, error) {
+	statefulSets, err := d.clientset.AppsV1().StatefulSets(namespaceName).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	for _, statefulSet := range statefulSets.Items {
+		if statefulSet.Spec.ServiceName == serviceName {
+			return getReplicas(statefulSet.Spec.Replicas), nil
+		}
+	}
+	service, err := d.clientset.CoreV1().Services(namespaceName).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if len(service.Spec.Selector) > 0 {
+		selector := labels.SelectorFromSet(service.Spec.Selector)
+		for _, statefulSet := range statefulSets.Items {
+			if selector.Matches(labels.Set(statefulSet.Spec.Template.Labels)) {
+				return getReplicas(statefulSet.Spec.Replicas), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no StatefulSet governs service %s/%s", namespaceName, serviceName)
+}
+
+// getReplicas returns the replica count of a spec, which defaults to 1
+func getReplicas(replicas *int32) int {
+	if replicas == nil {
+		return 1
+	}
+	return int(*replicas)
+}
@@ -0,0 +1,34 @@
+package discovery
+
+import (
+	"fmt"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+)
+
+// FormatStats summarizes the subsets, addresses and ports of the endpoints object
+func FormatStats(endpoints *core.Endpoints) string {
+	var b strings.Builder
+	ready, notReady, ports := 0, 0, 0
+	for _, ss := range endpoints.Subsets {
+		ready += len(ss.Addresses)
+		notReady += len(ss.NotReadyAddresses)
+		ports += len(ss.Ports)
+	}
+	fmt.Fprintf(&b, "Endpoints %s/%s: %d subsets, %d ready addresses, %d not-ready addresses, %d ports\n",
+		endpoints.Namespace, endpoints.Name, len(endpoints.Subsets), ready, notReady, ports)
+	for i, ss := range endpoints.Subsets {
+		names := []string{}
+		for _, port := range ss.Ports {
+			name := port.Name
+			if name == "" {
+				name = "<unnamed>"
+			}
+			names = append(names, fmt.Sprintf("%s=%d/%s", name, port.Port, port.Protocol))
+		}
+		fmt.Fprintf(&b, "  subset %d: %d ready, %d not-ready, ports [%s]\n",
+			i, len(ss.Addresses), len(ss.NotReadyAddresses), strings.Join(names, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"context"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Watch polls the services on every change of their Endpoints, EndpointSlices or pods and passes
+// the result to onChange. The watch is re-established whenever it closes; Watch returns
+// once the context is cancelled. With StartCache the changes come from the cache. The DNS backend
+// has nothing to watch and polls every interval, or once the records expire with DNSTTL.
+func (d *Discoverer) Watch(ctx context.Context, opts Options, onChange func(*Result)) {
+	if d.cache != nil {
+		changes := make(chan struct{}, 1)
+		d.cache.onChange(func() {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		})
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changes:
+				onChange(d.Poll(ctx, opts))
+			}
+		}
+	}
+	if opts.Backend == BackendDNS {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.dnsWait(ctx, opts)):
+				onChange(d.Poll(ctx, opts))
+			}
+		}
+	}
+	for {
+		watcher, err := d.watchEndpoints(ctx, opts)
+		if err != nil {
+			log.Warningf("Unable to watch endpoints: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(waitInterval(opts)):
+			}
+			continue
+		}
+		if !watchChanges(ctx, watcher, func() { onChange(d.Poll(ctx, opts)) }) {
+			return
+		}
+		log.Infof("Endpoints watch closed, reconnecting")
+	}
+}
+
+// watchEndpoints watches the Endpoints or EndpointSlices of the discovered services, or the
+// pods matching the pod selector, or the Services themselves for their load balancers
+func (d *Discoverer) watchEndpoints(ctx context.Context, opts Options) (watch.Interface, error) {
+	options := metav1.ListOptions{}
+	namespaceName := watchNamespace(opts)
+	if opts.PodSelector != nil {
+		options.LabelSelector = opts.PodSelector.String()
+		return d.clientset.CoreV1().Pods(namespaceName).Watch(ctx, options)
+	}
+	if opts.LoadBalancer {
+		// the ingress points are in the status of the Service
+		if len(opts.Services) == 0 && !ListsServices(opts) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", opts.Service).String()
+		}
+		return d.clientset.CoreV1().Services(namespaceName).Watch(ctx, options)
+	}
+	if opts.Backend == BackendEndpointSlices {
+		if len(opts.Services) == 0 && !ListsServices(opts) {
+			options.LabelSelector = discoveryv1.LabelServiceName + "=" + opts.Service
+		}
+		return d.clientset.DiscoveryV1().EndpointSlices(namespaceName).Watch(ctx, options)
+	}
+	if len(opts.Services) == 0 && !ListsServices(opts) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", opts.Service).String()
+	}
+	return d.clientset.CoreV1().Endpoints(namespaceName).Watch(ctx, options)
+}
+
+// watchChanges calls onChange for every watch event until the watch closes or the context is done.
+// It returns false when the context is done.
+func watchChanges(ctx context.Context, watcher watch.Interface, onChange func()) bool {
+	defer watcher.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return true
+			}
+			if event.Type == watch.Error {
+				log.Warningf("Endpoints watch error: %v", event.Object)
+				return true
+			}
+			onChange()
+		}
+	}
+}
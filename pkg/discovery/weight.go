@@ -0,0 +1,159 @@
+package discovery
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var ordinalRe = regexp.MustCompile(`^[^.]*-(\d+)\.`)
+
+// getWeight reads the numeric weight annotation of the address target pod, falling back to the baseline
+func getWeight(ctx context.Context, lookups *lookupCache, address core.EndpointAddress, annotation string, baseline float64) float64 {
+	pod, err := lookups.getTarget(ctx, address)
+	if err != nil {
+		log.Warningf("Unable to get the target pod of %s: %v", address.IP, err)
+		return baseline
+	}
+	if pod == nil {
+		return baseline
+	}
+	value, ok := pod.Annotations[annotation]
+	if !ok {
+		return baseline
+	}
+	weight, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Warningf("Ignoring invalid %s annotation %q on pod %s", annotation, value, pod.Name)
+		return baseline
+	}
+	return weight
+}
+
+// Ordinal returns the StatefulSet ordinal of the host, or -1 when it has none
+func Ordinal(host string) int {
+	return ParseOrdinal(host, nil)
+}
+
+// ParseOrdinal returns the number captured by the first group of the regex in the host, or -1
+// when it doesn't match. A nil regex matches the StatefulSet ordinal, the digits after the last
+// dash of the first label, whatever the length of either.
+func ParseOrdinal(host string, re *regexp.Regexp) int {
+	if re == nil {
+		re = ordinalRe
+		host += "."
+	}
+	match := re.FindStringSubmatch(host)
+	if len(match) < 2 {
+		return -1
+	}
+	ordinal, err := strconv.Atoi(match[1])
+	if err != nil {
+		return -1
+	}
+	return ordinal
+}
+
+// sortByWeight orders the endpoints by weight descending, breaking ties by ordinal, the endpoints
+// without one last, and then by name
+func sortByWeight(endpoints []Endpoint, weights map[string]float64, ordinalRegex *regexp.Regexp) {
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if weights[a.FQDN] != weights[b.FQDN] {
+			return weights[a.FQDN] > weights[b.FQDN]
+		}
+		if less, ok := ordinalLess(a, b, ordinalRegex); ok {
+			return less
+		}
+		return a.FQDN < b.FQDN
+	})
+}
+
+// seenOrder remembers the order in which endpoints were first observed across polls
+type seenOrder struct {
+	mu      sync.Mutex
+	entries map[string]seenEntry
+	// next is the position of the next endpoint observed, after all the remembered ones
+	next int
+	// services are the UIDs of the services the endpoints were observed in
+	services map[ServiceRef]types.UID
+}
+
+// seenEntry is the first-seen position of an endpoint and the pod it was observed on
+type seenEntry struct {
+	position int
+	podUID   string
+	service  ServiceRef
+}
+
+func newSeenOrder() *seenOrder {
+	return &seenOrder{entries: map[string]seenEntry{}, services: map[ServiceRef]types.UID{}}
+}
+
+// observeServices forgets the positions of the endpoints of the services recreated since the
+// last poll, recognized by the new UID of their endpoints object, so that the endpoints of the
+// new service are ordered as observed again rather than mixed with those of the old one
+func (o *seenOrder) observeServices(objects []*core.Endpoints) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, object := range objects {
+		if object.UID == "" {
+			continue
+		}
+		ref := ServiceRef{Namespace: object.Namespace, Name: object.Name}
+		previous, ok := o.services[ref]
+		o.services[ref] = object.UID
+		if !ok || previous == object.UID {
+			continue
+		}
+		log.Info("Service recreated, resetting the first-seen order of its endpoints", "service", ref.String())
+		for name, entry := range o.entries {
+			if entry.service == ref {
+				delete(o.entries, name)
+			}
+		}
+	}
+}
+
+// sort records newly observed endpoints and orders all of them by first-seen position.
+// Endpoints observed in the same poll keep their ordinal order, and an endpoint whose pod was
+// recreated, with another UID, is observed anew. With prune, the endpoints are those of a
+// complete poll and the positions of the endpoints gone from it are forgotten, so that an
+// endpoint coming back is placed after the current ones.
+func (o *seenOrder) sort(endpoints []Endpoint, prune bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	current := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		current[endpoint.FQDN] = true
+		entry, ok := o.entries[endpoint.FQDN]
+		if ok && entry.podUID != "" && endpoint.PodUID != "" && entry.podUID != endpoint.PodUID {
+			log.Info("Pod recreated, resetting its first-seen position", "endpoint", endpoint.FQDN, "pod", endpoint.PodName)
+			ok = false
+		}
+		if !ok {
+			o.entries[endpoint.FQDN] = seenEntry{
+				position: o.next,
+				podUID:   endpoint.PodUID,
+				service:  ServiceRef{Namespace: endpoint.Namespace, Name: endpoint.Service},
+			}
+			o.next++
+		}
+	}
+	if prune {
+		for name := range o.entries {
+			if !current[name] {
+				delete(o.entries, name)
+			}
+		}
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return o.entries[endpoints[i].FQDN].position < o.entries[endpoints[j].FQDN].position
+	})
+}
@@ -0,0 +1,65 @@
+package discovery
+
+import (
+	"context"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// zoneLabels are the node labels carrying the availability zone, newest first
+var zoneLabels = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+
+// Zone resolves the availability zone of the node, or unknown when it can't be determined
+func (d *Discoverer) Zone(ctx context.Context, nodeName string) string {
+	node, err := d.lookups.getNode(ctx, nodeName)
+	if err != nil {
+		if d.lookups.firstFailure(nodeName) {
+			log.Warningf("Unable to get node %s: %v", nodeName, err)
+		}
+		return "unknown"
+	}
+	return nodeZone(node)
+}
+
+// EndpointZone returns the availability zone of the endpoint: the zone of its EndpointSlice
+// endpoint, or the one of its node, unknown for an endpoint without a node
+func (d *Discoverer) EndpointZone(ctx context.Context, endpoint Endpoint) string {
+	if endpoint.Zone != "" {
+		return endpoint.Zone
+	}
+	if endpoint.NodeName == "" {
+		return "unknown"
+	}
+	return d.Zone(ctx, endpoint.NodeName)
+}
+
+// nodeZone returns the availability zone label of the node, or unknown when it has none
+func nodeZone(node *core.Node) string {
+	if node != nil {
+		for _, label := range zoneLabels {
+			if zone := node.Labels[label]; zone != "" {
+				return zone
+			}
+		}
+	}
+	return "unknown"
+}
+
+// inTopology reports whether the node of the address is in opts.Zone and matches
+// opts.NodeSelector, addresses without a node never matching
+func (d *Discoverer) inTopology(ctx context.Context, opts Options, address core.EndpointAddress) bool {
+	if address.NodeName == nil {
+		return false
+	}
+	node, err := d.lookups.getNode(ctx, *address.NodeName)
+	if err != nil || node == nil {
+		log.Warningf("Excluding %s: unable to get node %s: %v", address.IP, *address.NodeName, err)
+		return false
+	}
+	if opts.NodeSelector != nil && !opts.NodeSelector.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	return opts.Zone == "" || nodeZone(node) == opts.Zone
+}
@@ -0,0 +1,798 @@
+package format
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+)
+
+func init() {
+	RegisterWriter("default", writeDefault)
+	RegisterWriter("zookeeper", writeZookeeper)
+	RegisterWriter("zookeeper-dynamic", writeZookeeperDynamic)
+	Register("solr", formatSolr)
+	Register("elasticsearch", formatElasticsearch)
+	Register("elasticsearch7", formatElasticsearch7)
+	Register("golang", formatGoLiteral)
+	Register("zones", formatZones)
+	Register("keepalived", formatKeepalived)
+	Register("kafka", formatKafka)
+	Register("etcd", formatEtcd)
+	Register("vault", formatVault)
+	Register("minio", formatMinio)
+	Register("cassandra", formatCassandra)
+	Register("cockroachdb", formatCockroachDB)
+	Register("nats", formatNats)
+	Register("hazelcast", formatHazelcast)
+	Register("ignite", formatIgnite)
+	Register("ignite-properties", formatIgniteProperties)
+	Register("clickhouse", formatClickHouse)
+	Register("redis-sentinel", formatRedisSentinel)
+	Register("redis-cluster", formatRedisCluster)
+	Register("patroni", formatPatroni)
+	Register("pg-hba", formatPgHba)
+	Register("mongodb", formatMongoDB)
+	Register("rabbitmq", formatRabbitMQ)
+	Register("consul", formatConsul)
+	Register("consul-json", formatConsulJSON)
+	Register("prometheus", formatPrometheus)
+	Register("haproxy", formatHAProxy)
+	Register("nginx", formatNginx)
+	Register("ansible", formatAnsible)
+	Register("ansible-json", formatAnsibleJSON)
+	RegisterWriter("hosts", writeHosts)
+	RegisterWriter("dnsmasq", writeDnsmasq)
+	RegisterWriter("env", writeEnv)
+}
+
+// writeDefault writes the comma separated names followed by their readiness suffix, without a
+// trailing newline, byte for byte the output of the first releases
+func writeDefault(w io.Writer, endpoints []discovery.Endpoint, options Options) error {
+	b := bufio.NewWriter(w)
+	for i, endpoint := range endpoints {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(endpoint.FQDN)
+		b.WriteString(readiness(endpoint, options))
+	}
+	return b.Flush()
+}
+
+// zookeeperPorts returns the quorum, election and client ports of the endpoint, from its ports
+// named server or peer, leader-election or election and client when the service exposes them
+func zookeeperPorts(endpoint discovery.Endpoint) (int32, int32, int32) {
+	return namedPort(endpoint, "server", namedPort(endpoint, "peer", 2888)),
+		namedPort(endpoint, "leader-election", namedPort(endpoint, "election", 3888)),
+		namedPort(endpoint, "client", 2181)
+}
+
+// writeZookeeper writes the ensemble server lines on the ports of zookeeperPorts
+func writeZookeeper(w io.Writer, endpoints []discovery.Endpoint, options Options) error {
+	b := bufio.NewWriter(w)
+	for _, endpoint := range endpoints {
+		index, err := ordinal(endpoint, options)
+		if err != nil {
+			return err
+		}
+		server, election, client := zookeeperPorts(endpoint)
+		fmt.Fprintf(b, "server.%d=%s:%d:%d;%d\n", index+1+options.IndexOffset, host(endpoint), server, election, client)
+	}
+	return b.Flush()
+}
+
+// writeZookeeperDynamic writes the server lines of a ZooKeeper 3.5+ dynamic configuration file,
+// every endpoint being a participant on the ports of zookeeperPorts
+func writeZookeeperDynamic(w io.Writer, endpoints []discovery.Endpoint, options Options) error {
+	b := bufio.NewWriter(w)
+	for _, endpoint := range endpoints {
+		index, err := ordinal(endpoint, options)
+		if err != nil {
+			return err
+		}
+		server, election, client := zookeeperPorts(endpoint)
+		fmt.Fprintf(b, "server.%d=%s:%d:%d:participant;%d\n", index+1+options.IndexOffset, host(endpoint), server, election, client)
+	}
+	return b.Flush()
+}
+
+// formatSolr renders the ZK_HOST connection string of SolrCloud from the ZooKeeper endpoints,
+// on their port named client or 2181, followed by the chroot
+func formatSolr(endpoints []discovery.Endpoint, options Options) (string, error) {
+	chroot := options.SolrChroot
+	switch {
+	case chroot == "":
+		chroot = "/solr"
+	case chroot == "/":
+		chroot = ""
+	case !strings.HasPrefix(chroot, "/"):
+		chroot = "/" + chroot
+	}
+	hosts := []string{}
+	for _, endpoint := range endpoints {
+		hosts = append(hosts, hostPort(endpoint, namedPort(endpoint, "client", 2181)))
+	}
+	return strings.Join(hosts, ",") + chroot + "\n", nil
+}
+
+// namedPort returns the number of the endpoint port with the name, or the fallback when there is none
+func namedPort(endpoint discovery.Endpoint, name string, fallback int32) int32 {
+	for _, port := range endpoint.Ports {
+		if port.Name == name {
+			return port.Port
+		}
+	}
+	return fallback
+}
+
+func formatElasticsearch(endpoints []discovery.Endpoint, options Options) (string, error) {
+	output := fmt.Sprintf("discovery.zen.ping.unicast.hosts: [%s]\n", strings.Join(discovery.Names(endpoints), ", "))
+	if options.MinimumMasterNodes {
+		output += fmt.Sprintf("discovery.zen.minimum_master_nodes: %d\n", Quorum(len(endpoints)))
+	}
+	return output, nil
+}
+
+// formatElasticsearch7 renders the seed hosts and initial master nodes of Elasticsearch 7 and
+// OpenSearch, the node names being the pod hostnames
+func formatElasticsearch7(endpoints []discovery.Endpoint, options Options) (string, error) {
+	nodes := []string{}
+	for _, endpoint := range endpoints {
+		nodes = append(nodes, endpoint.Hostname)
+	}
+	return fmt.Sprintf("discovery.seed_hosts: [%s]\ncluster.initial_master_nodes: [%s]\n",
+		strings.Join(discovery.Names(endpoints), ", "), strings.Join(nodes, ", ")), nil
+}
+
+// formatGoLiteral renders the hosts as a Go slice literal, optionally wrapped in a var declaration.
+// A custom element type must be a string-based type for the literal to compile, or with
+// GoStructured a struct type with the Hostname, FQDN, IP and Port fields, Endpoint by default.
+func formatGoLiteral(endpoints []discovery.Endpoint, options Options) (string, error) {
+	elemType := options.GoType
+	elements := []string{}
+	if options.GoStructured {
+		if elemType == "" {
+			elemType = "Endpoint"
+		}
+		for _, endpoint := range endpoints {
+			elements = append(elements, fmt.Sprintf("{Hostname: %s, FQDN: %s, IP: %s, Port: %d}",
+				strconv.Quote(endpoint.Hostname), strconv.Quote(endpoint.FQDN), strconv.Quote(endpoint.IP), endpoint.Port))
+		}
+	} else {
+		if elemType == "" {
+			elemType = "string"
+		}
+		for _, host := range discovery.Names(endpoints) {
+			elements = append(elements, strconv.Quote(host))
+		}
+	}
+	literal := fmt.Sprintf("[]%s{%s}", elemType, strings.Join(elements, ", "))
+	if options.GoVar != "" {
+		return fmt.Sprintf("var %s = %s\n", options.GoVar, literal), nil
+	}
+	return literal + "\n", nil
+}
+
+// formatZones groups the hosts by availability zone as a JSON object
+func formatZones(endpoints []discovery.Endpoint, options Options) (string, error) {
+	zones := map[string][]string{}
+	for _, endpoint := range endpoints {
+		name := zone(endpoint, options)
+		if name == "" {
+			name = "unknown"
+		}
+		zones[name] = append(zones[name], endpoint.FQDN)
+	}
+	data, err := json.Marshal(zones)
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// formatKeepalived renders a unicast_peer block with the endpoint IPs, leaving out the local pod
+// so that a node doesn't list itself as a VRRP peer
+func formatKeepalived(endpoints []discovery.Endpoint, options Options) (string, error) {
+	var b strings.Builder
+	b.WriteString("unicast_peer {\n")
+	for _, endpoint := range endpoints {
+		if endpoint.IP == "" || endpoint.IP == options.SelfIP {
+			continue
+		}
+		fmt.Fprintf(&b, "    %s\n", endpoint.IP)
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+// formatKafka renders the KRaft controller.quorum.voters setting, using the StatefulSet ordinal as the node id
+func formatKafka(endpoints []discovery.Endpoint, options Options) (string, error) {
+	port := options.KafkaPort
+	if port == 0 {
+		port = 9093
+	}
+	voters := []string{}
+	for _, endpoint := range endpoints {
+		index, err := ordinal(endpoint, options)
+		if err != nil {
+			return "", err
+		}
+		voters = append(voters, fmt.Sprintf("%d@%s:%d", index+options.IndexOffset, host(endpoint), port))
+	}
+	return fmt.Sprintf("controller.quorum.voters=%s\n", strings.Join(voters, ",")), nil
+}
+
+// formatEtcd renders the --initial-cluster flag of etcd, naming each member after its hostname
+func formatEtcd(endpoints []discovery.Endpoint, options Options) (string, error) {
+	scheme, port := options.EtcdScheme, options.EtcdPeerPort
+	if scheme == "" {
+		scheme = "http"
+	}
+	if port == 0 {
+		port = 2380
+	}
+	members := []string{}
+	for _, endpoint := range endpoints {
+		members = append(members, fmt.Sprintf("%s=%s://%s:%d", endpoint.Hostname, scheme, host(endpoint), port))
+	}
+	return fmt.Sprintf("--initial-cluster=%s\n", strings.Join(members, ",")), nil
+}
+
+// formatVault renders a retry_join stanza per endpoint for the auto-join of the Raft storage
+func formatVault(endpoints []discovery.Endpoint, options Options) (string, error) {
+	scheme, port := options.VaultScheme, options.VaultPort
+	if scheme == "" {
+		scheme = "https"
+	}
+	if port == 0 {
+		port = 8200
+	}
+	var b strings.Builder
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(&b, "retry_join {\n  leader_api_addr = %q\n}\n", scheme+"://"+hostPort(endpoint, port))
+	}
+	return b.String(), nil
+}
+
+// formatMinio renders the server arguments of MinIO distributed mode, a single URL with the
+// {x...y} ellipsis expansion when the endpoints are consecutive StatefulSet ordinals, the
+// space-separated URLs of all of them otherwise
+func formatMinio(endpoints []discovery.Endpoint, options Options) (string, error) {
+	scheme, port, path := options.MinioScheme, options.MinioPort, options.MinioPath
+	if scheme == "" {
+		scheme = "https"
+	}
+	if port == 0 {
+		port = 9000
+	}
+	if path == "" {
+		path = "/data"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if !options.MinioList {
+		if expansion, ok := minioExpansion(endpoints, options); ok {
+			return fmt.Sprintf("%s://%s:%d%s\n", scheme, expansion, port, path), nil
+		}
+	}
+	servers := []string{}
+	for _, endpoint := range endpoints {
+		servers = append(servers, fmt.Sprintf("%s://%s%s", scheme, hostPort(endpoint, port), path))
+	}
+	return strings.Join(servers, " ") + "\n", nil
+}
+
+// minioExpansion returns the host of the endpoints with their ordinal replaced by the {x...y}
+// ellipsis, when their names only differ by consecutive ordinals
+func minioExpansion(endpoints []discovery.Endpoint, options Options) (string, bool) {
+	if len(endpoints) < 2 {
+		return "", false
+	}
+	pattern := ""
+	ordinals := []int{}
+	for _, endpoint := range endpoints {
+		index, err := ordinal(endpoint, options)
+		if err != nil {
+			return "", false
+		}
+		digits := strconv.Itoa(index)
+		name := host(endpoint)
+		if !strings.HasSuffix(endpoint.Hostname, digits) || !strings.HasPrefix(name, endpoint.Hostname) {
+			return "", false
+		}
+		prefix := strings.TrimSuffix(endpoint.Hostname, digits)
+		p := prefix + "%s" + strings.TrimPrefix(name, endpoint.Hostname)
+		if pattern != "" && p != pattern {
+			return "", false
+		}
+		pattern = p
+		ordinals = append(ordinals, index)
+	}
+	sort.Ints(ordinals)
+	for i := 1; i < len(ordinals); i++ {
+		if ordinals[i] != ordinals[i-1]+1 {
+			return "", false
+		}
+	}
+	return fmt.Sprintf(pattern, fmt.Sprintf("{%d...%d}", ordinals[0], ordinals[len(ordinals)-1])), true
+}
+
+// formatCassandra renders a comma separated seed list, limited to the first endpoints
+// since seeds shouldn't be every node
+func formatCassandra(endpoints []discovery.Endpoint, options Options) (string, error) {
+	seeds := discovery.Names(endpoints)
+	if options.CassandraSeeds > 0 && len(seeds) > options.CassandraSeeds {
+		seeds = seeds[:options.CassandraSeeds]
+	}
+	return strings.Join(seeds, ",") + "\n", nil
+}
+
+// formatCockroachDB renders the --join flag of cockroach start, limited to the lowest ordinals
+// since a few stable members are enough to join the cluster
+func formatCockroachDB(endpoints []discovery.Endpoint, options Options) (string, error) {
+	port := options.CockroachPort
+	if port == 0 {
+		port = 26257
+	}
+	if limit := options.CockroachJoinLimit; limit > 0 && len(endpoints) > limit {
+		endpoints = append([]discovery.Endpoint{}, endpoints...)
+		sort.SliceStable(endpoints, func(i, j int) bool {
+			a := discovery.ParseOrdinal(endpoints[i].Hostname, options.OrdinalRegex)
+			b := discovery.ParseOrdinal(endpoints[j].Hostname, options.OrdinalRegex)
+			return a >= 0 && (b < 0 || a < b)
+		})
+		endpoints = endpoints[:limit]
+	}
+	members := []string{}
+	for _, endpoint := range endpoints {
+		members = append(members, hostPort(endpoint, port))
+	}
+	return fmt.Sprintf("--join=%s\n", strings.Join(members, ",")), nil
+}
+
+// formatNats renders the routes setting of the cluster block of the NATS server configuration
+func formatNats(endpoints []discovery.Endpoint, options Options) (string, error) {
+	scheme, port := options.NatsScheme, options.NatsPort
+	if scheme == "" {
+		scheme = "nats"
+	}
+	if port == 0 {
+		port = 6222
+	}
+	routes := []string{}
+	for _, endpoint := range endpoints {
+		routes = append(routes, scheme+"://"+hostPort(endpoint, port))
+	}
+	return fmt.Sprintf("routes: [%s]\n", strings.Join(routes, ", ")), nil
+}
+
+// formatHazelcast renders the tcp-ip join member list of a Hazelcast XML configuration
+func formatHazelcast(endpoints []discovery.Endpoint, options Options) (string, error) {
+	port := options.HazelcastPort
+	if port == 0 {
+		port = 5701
+	}
+	var b strings.Builder
+	b.WriteString("<tcp-ip enabled=\"true\">\n  <member-list>\n")
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(&b, "    <member>%s</member>\n", hostPort(endpoint, port))
+	}
+	b.WriteString("  </member-list>\n</tcp-ip>\n")
+	return b.String(), nil
+}
+
+// igniteAddresses returns the TcpDiscoveryVmIpFinder addresses of the endpoints, with the port
+// range when one is set
+func igniteAddresses(endpoints []discovery.Endpoint, options Options) []string {
+	port := options.IgnitePort
+	if port == 0 {
+		port = 47500
+	}
+	addresses := []string{}
+	for _, endpoint := range endpoints {
+		address := hostPort(endpoint, port)
+		if options.IgnitePortRange > 0 {
+			address += fmt.Sprintf("..%d", int(port)+options.IgnitePortRange)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// formatIgnite renders the addresses property of a TcpDiscoveryVmIpFinder Spring XML bean
+func formatIgnite(endpoints []discovery.Endpoint, options Options) (string, error) {
+	var b strings.Builder
+	b.WriteString("<property name=\"addresses\">\n  <list>\n")
+	for _, address := range igniteAddresses(endpoints, options) {
+		fmt.Fprintf(&b, "    <value>%s</value>\n", address)
+	}
+	b.WriteString("  </list>\n</property>\n")
+	return b.String(), nil
+}
+
+// formatIgniteProperties renders the TcpDiscoveryVmIpFinder addresses as a properties entry
+func formatIgniteProperties(endpoints []discovery.Endpoint, options Options) (string, error) {
+	return fmt.Sprintf("addresses=%s\n", strings.Join(igniteAddresses(endpoints, options), ",")), nil
+}
+
+// formatClickHouse renders the remote_servers configuration of the cluster, dealing the endpoints
+// round-robin over the shards so that scaling the StatefulSet by the shard count adds a replica
+// to each of them
+func formatClickHouse(endpoints []discovery.Endpoint, options Options) (string, error) {
+	cluster, shards, port := options.ClickHouseCluster, options.ClickHouseShards, options.ClickHousePort
+	if cluster == "" && len(endpoints) > 0 {
+		cluster = endpoints[0].Service
+	}
+	if shards <= 0 {
+		shards = 1
+	}
+	if port == 0 {
+		port = 9000
+	}
+	replicas := make([][]discovery.Endpoint, shards)
+	for i, endpoint := range endpoints {
+		replicas[i%shards] = append(replicas[i%shards], endpoint)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<remote_servers>\n  <%s>\n", cluster)
+	for _, shard := range replicas {
+		if len(shard) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "    <shard>\n      <internal_replication>%t</internal_replication>\n", len(shard) > 1)
+		for _, endpoint := range shard {
+			fmt.Fprintf(&b, "      <replica>\n        <host>%s</host>\n        <port>%d</port>\n      </replica>\n", endpoint.FQDN, port)
+		}
+		b.WriteString("    </shard>\n")
+	}
+	fmt.Fprintf(&b, "  </%s>\n</remote_servers>\n", cluster)
+	return b.String(), nil
+}
+
+// redisPort returns the port of the redis formats
+func redisPort(options Options) int32 {
+	if options.RedisPort == 0 {
+		return 6379
+	}
+	return options.RedisPort
+}
+
+// formatRedisSentinel renders the sentinel monitor line of the master, the endpoint with the
+// lowest ordinal, or the first one when the hostnames carry none
+func formatRedisSentinel(endpoints []discovery.Endpoint, options Options) (string, error) {
+	if len(endpoints) == 0 {
+		return "", fmt.Errorf("no endpoint to monitor")
+	}
+	master, lowest := endpoints[0], -1
+	for _, endpoint := range endpoints {
+		if index := discovery.ParseOrdinal(endpoint.Hostname, options.OrdinalRegex); index >= 0 && (lowest < 0 || index < lowest) {
+			master, lowest = endpoint, index
+		}
+	}
+	name, quorum := options.RedisMaster, options.RedisQuorum
+	if name == "" {
+		name = "mymaster"
+	}
+	if quorum == 0 {
+		quorum = Quorum(len(endpoints))
+	}
+	return fmt.Sprintf("sentinel monitor %s %s %d %d\n", name, master.FQDN, redisPort(options), quorum), nil
+}
+
+// formatRedisCluster renders the arguments of redis-cli creating a Redis Cluster of the endpoints
+func formatRedisCluster(endpoints []discovery.Endpoint, options Options) (string, error) {
+	args := []string{"--cluster", "create"}
+	for _, endpoint := range endpoints {
+		args = append(args, hostPort(endpoint, redisPort(options)))
+	}
+	if options.RedisClusterReplicas > 0 {
+		args = append(args, "--cluster-replicas", strconv.Itoa(options.RedisClusterReplicas))
+	}
+	return strings.Join(args, " ") + "\n", nil
+}
+
+// formatPatroni renders the comma separated host:port list of the etcd3.hosts or zookeeper.hosts
+// setting of Patroni, the DCS endpoints being discovered
+func formatPatroni(endpoints []discovery.Endpoint, options Options) (string, error) {
+	hosts := []string{}
+	for _, endpoint := range endpoints {
+		port := options.PatroniPort
+		if port == 0 {
+			port = endpoint.Port
+		}
+		if port == 0 {
+			port = 2379
+		}
+		hosts = append(hosts, hostPort(endpoint, port))
+	}
+	return strings.Join(hosts, ",") + "\n", nil
+}
+
+// formatPgHba renders a pg_hba.conf line per peer IP, allowing the PostgreSQL replication and
+// monitoring connections between the members
+func formatPgHba(endpoints []discovery.Endpoint, options Options) (string, error) {
+	method := options.PgHbaMethod
+	if method == "" {
+		method = "md5"
+	}
+	var b strings.Builder
+	for _, endpoint := range endpoints {
+		ip := net.ParseIP(endpoint.IP)
+		if ip == nil {
+			continue
+		}
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		fmt.Fprintf(&b, "host all all %s/%d %s\n", endpoint.IP, bits, method)
+	}
+	return b.String(), nil
+}
+
+type mongoMember struct {
+	ID   int    `json:"_id"`
+	Host string `json:"host"`
+}
+
+type mongoReplicaSet struct {
+	ID      string        `json:"_id"`
+	Members []mongoMember `json:"members"`
+}
+
+// formatMongoDB renders an rs.initiate call for the replica set, using the StatefulSet ordinal
+// as the member id and the endpoint port, 27017 when the endpoint has none
+func formatMongoDB(endpoints []discovery.Endpoint, options Options) (string, error) {
+	rs := mongoReplicaSet{ID: options.MongoReplicaSet, Members: []mongoMember{}}
+	for _, endpoint := range endpoints {
+		if rs.ID == "" {
+			rs.ID = endpoint.Service
+		}
+		index, err := ordinal(endpoint, options)
+		if err != nil {
+			return "", err
+		}
+		port := endpoint.Port
+		if port == 0 {
+			port = 27017
+		}
+		rs.Members = append(rs.Members, mongoMember{ID: index + options.IndexOffset, Host: hostPort(endpoint, port)})
+	}
+	data, err := json.Marshal(rs)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rs.initiate(%s)\n", data), nil
+}
+
+// formatRabbitMQ renders the classic_config peer discovery nodes of rabbitmq.conf
+func formatRabbitMQ(endpoints []discovery.Endpoint, options Options) (string, error) {
+	var b strings.Builder
+	for i, host := range discovery.Names(endpoints) {
+		fmt.Fprintf(&b, "cluster_formation.classic_config.nodes.%d = rabbit@%s\n", i+1, host)
+	}
+	return b.String(), nil
+}
+
+// formatConsul renders a -retry-join argument per host for the consul agent command line
+func formatConsul(endpoints []discovery.Endpoint, options Options) (string, error) {
+	args := []string{}
+	for _, host := range discovery.Names(endpoints) {
+		args = append(args, "-retry-join="+host)
+	}
+	return strings.Join(args, " ") + "\n", nil
+}
+
+// formatConsulJSON renders the retry_join setting of a consul JSON configuration file
+func formatConsulJSON(endpoints []discovery.Endpoint, options Options) (string, error) {
+	data, err := json.Marshal(map[string][]string{"retry_join": discovery.Names(endpoints)})
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// formatPrometheus renders a file_sd target group per service, labelled with its namespace and name
+func formatPrometheus(endpoints []discovery.Endpoint, options Options) (string, error) {
+	groups := []*targetGroup{}
+	byService := map[string]*targetGroup{}
+	for _, endpoint := range endpoints {
+		key := endpoint.Namespace + "/" + endpoint.Service
+		group, ok := byService[key]
+		if !ok {
+			group = &targetGroup{
+				Targets: []string{},
+				Labels:  map[string]string{"namespace": endpoint.Namespace, "service": endpoint.Service},
+			}
+			byService[key] = group
+			groups = append(groups, group)
+		}
+		target := endpoint.FQDN
+		if endpoint.Port != 0 {
+			target = hostPort(endpoint, endpoint.Port)
+		}
+		group.Targets = append(group.Targets, target)
+	}
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// proxyName returns the configured backend name, falling back to the service of the endpoints
+func proxyName(endpoints []discovery.Endpoint, options Options) string {
+	if options.ProxyName == "" && len(endpoints) > 0 {
+		return endpoints[0].Service
+	}
+	return options.ProxyName
+}
+
+// proxyAddress returns the host:port of the endpoint in a proxy server line
+func proxyAddress(endpoint discovery.Endpoint, options Options) string {
+	port := options.ProxyPort
+	if port == 0 {
+		port = endpoint.Port
+	}
+	if port == 0 {
+		return endpoint.FQDN
+	}
+	return hostPort(endpoint, port)
+}
+
+// haproxyServerName returns the name of the server line of the endpoint: its hostname, or for an
+// endpoint named by its IP the address with its dots and colons as dashes, or srv<n>
+func haproxyServerName(endpoint discovery.Endpoint, index int) string {
+	if endpoint.Hostname != "" {
+		return endpoint.Hostname
+	}
+	if endpoint.IP != "" {
+		return strings.NewReplacer(".", "-", ":", "-").Replace(endpoint.IP)
+	}
+	return fmt.Sprintf("srv%d", index+1)
+}
+
+// formatHAProxy renders a backend section with a checked server line per endpoint
+func formatHAProxy(endpoints []discovery.Endpoint, options Options) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "backend %s\n", proxyName(endpoints, options))
+	for i, endpoint := range endpoints {
+		fmt.Fprintf(&b, "    server %s %s check\n", haproxyServerName(endpoint, i), proxyAddress(endpoint, options))
+	}
+	return b.String(), nil
+}
+
+// formatNginx renders an upstream block with a server per endpoint
+func formatNginx(endpoints []discovery.Endpoint, options Options) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "upstream %s {\n", proxyName(endpoints, options))
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(&b, "    server %s;\n", proxyAddress(endpoint, options))
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+// ansibleGroups groups the endpoints by service, in the order the services were discovered. The
+// dashes of the service names become underscores, Ansible group names being identifiers.
+func ansibleGroups(endpoints []discovery.Endpoint) ([]string, map[string][]discovery.Endpoint) {
+	names := []string{}
+	groups := map[string][]discovery.Endpoint{}
+	for _, endpoint := range endpoints {
+		name := strings.Replace(endpoint.Service, "-", "_", -1)
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], endpoint)
+	}
+	return names, groups
+}
+
+// formatAnsible renders an INI inventory with a group of hosts per service
+func formatAnsible(endpoints []discovery.Endpoint, options Options) (string, error) {
+	var b strings.Builder
+	names, groups := ansibleGroups(endpoints)
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", name)
+		for _, endpoint := range groups[name] {
+			fmt.Fprintf(&b, "%s ansible_host=%s\n", endpoint.FQDN, endpoint.IP)
+		}
+	}
+	return b.String(), nil
+}
+
+type ansibleGroup struct {
+	Hosts []string `json:"hosts"`
+}
+
+// formatAnsibleJSON renders a dynamic inventory document with a group of hosts per service and the
+// IP of every host in its hostvars
+func formatAnsibleJSON(endpoints []discovery.Endpoint, options Options) (string, error) {
+	inventory := map[string]interface{}{}
+	hostvars := map[string]map[string]string{}
+	names, groups := ansibleGroups(endpoints)
+	for _, name := range names {
+		group := &ansibleGroup{Hosts: []string{}}
+		for _, endpoint := range groups[name] {
+			group.Hosts = append(group.Hosts, endpoint.FQDN)
+			hostvars[endpoint.FQDN] = map[string]string{"ansible_host": endpoint.IP}
+		}
+		inventory[name] = group
+	}
+	inventory["_meta"] = map[string]interface{}{"hostvars": hostvars}
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// hostNames returns the FQDN and the hostname of the endpoint that aren't its IP
+func hostNames(endpoint discovery.Endpoint) []string {
+	names := []string{}
+	if endpoint.FQDN != endpoint.IP {
+		names = append(names, endpoint.FQDN)
+	}
+	if endpoint.Hostname != "" && endpoint.Hostname != endpoint.FQDN {
+		names = append(names, endpoint.Hostname)
+	}
+	return names
+}
+
+// writeHosts writes an /etc/hosts line per endpoint with its FQDN and hostname, also usable as
+// a dnsmasq addn-hosts file
+func writeHosts(w io.Writer, endpoints []discovery.Endpoint, options Options) error {
+	b := bufio.NewWriter(w)
+	for _, endpoint := range endpoints {
+		if names := hostNames(endpoint); len(names) > 0 {
+			fmt.Fprintf(b, "%s %s\n", endpoint.IP, strings.Join(names, " "))
+		}
+	}
+	return b.Flush()
+}
+
+// writeDnsmasq writes a dnsmasq host-record line per endpoint with its FQDN and hostname
+func writeDnsmasq(w io.Writer, endpoints []discovery.Endpoint, options Options) error {
+	b := bufio.NewWriter(w)
+	for _, endpoint := range endpoints {
+		if names := hostNames(endpoint); len(names) > 0 {
+			fmt.Fprintf(b, "host-record=%s,%s\n", strings.Join(names, ","), endpoint.IP)
+		}
+	}
+	return b.Flush()
+}
+
+// writeEnv writes a <prefix>_N=host:port variable per endpoint and <prefix>_COUNT, for sourcing
+// in a shell or loading through envFrom
+func writeEnv(w io.Writer, endpoints []discovery.Endpoint, options Options) error {
+	prefix := options.EnvPrefix
+	if prefix == "" {
+		prefix = "PEER"
+	}
+	b := bufio.NewWriter(w)
+	for i, endpoint := range endpoints {
+		address := endpoint.FQDN
+		if endpoint.Port != 0 {
+			address = hostPort(endpoint, endpoint.Port)
+		}
+		fmt.Fprintf(b, "%s_%d=%s\n", prefix, i, address)
+	}
+	fmt.Fprintf(b, "%s_COUNT=%d\n", prefix, len(endpoints))
+	return b.Flush()
+}
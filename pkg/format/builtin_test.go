@@ -0,0 +1,97 @@
+package format
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// TestGoLiteralParses checks that the golang format is valid Go, as an expression and as a
+// variable declaration
+func TestGoLiteralParses(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		options Options
+	}{
+		{"literal", Options{}},
+		{"element type", Options{GoType: "interface{}"}},
+		{"variable", Options{GoVar: "peers"}},
+		{"typed variable", Options{GoType: "any", GoVar: "Seeds"}},
+		{"structured", Options{GoStructured: true}},
+		{"structured variable", Options{GoStructured: true, GoType: "fixtures.Peer", GoVar: "peers"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			endpoints := SampleEndpoints()
+			// quotes and backslashes in the names must be escaped
+			endpoints[0].FQDN = `zk-0."quoted"\name`
+			output, err := formatGoLiteral(endpoints, c.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.options.GoVar == "" {
+				if _, err := parser.ParseExpr(output); err != nil {
+					t.Errorf("%q doesn't parse as a Go expression: %v", output, err)
+				}
+				return
+			}
+			if _, err := parser.ParseFile(token.NewFileSet(), "peers.go", "package peers\n\n"+output, 0); err != nil {
+				t.Errorf("%q doesn't parse as a Go declaration: %v", output, err)
+			}
+		})
+	}
+}
+
+func TestGoLiteralEmpty(t *testing.T) {
+	output, err := formatGoLiteral(nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "[]string{}\n" {
+		t.Errorf("formatGoLiteral(nil) = %q, want an empty slice", output)
+	}
+	if _, err := parser.ParseExpr(output); err != nil {
+		t.Errorf("%q doesn't parse: %v", output, err)
+	}
+}
+
+// TestGoLiteralStructured checks that the structured golang format is a composite literal of
+// keyed struct elements with the endpoint fields
+func TestGoLiteralStructured(t *testing.T) {
+	output, err := formatGoLiteral(SampleEndpoints(), Options{GoStructured: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := parser.ParseExpr(output)
+	if err != nil {
+		t.Fatalf("%q doesn't parse as a Go expression: %v", output, err)
+	}
+	literal, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		t.Fatalf("%q isn't a composite literal", output)
+	}
+	slice, ok := literal.Type.(*ast.ArrayType)
+	if !ok || slice.Len != nil {
+		t.Fatalf("%q isn't a slice literal", output)
+	}
+	if elem, ok := slice.Elt.(*ast.Ident); !ok || elem.Name != "Endpoint" {
+		t.Errorf("%q isn't a []Endpoint literal", output)
+	}
+	if len(literal.Elts) != 3 {
+		t.Fatalf("%q has %d elements, want 3", output, len(literal.Elts))
+	}
+	for _, element := range literal.Elts {
+		element, ok := element.(*ast.CompositeLit)
+		if !ok {
+			t.Fatalf("%q has an element that isn't a struct literal", output)
+		}
+		keys := []string{}
+		for _, field := range element.Elts {
+			keys = append(keys, field.(*ast.KeyValueExpr).Key.(*ast.Ident).Name)
+		}
+		if got := strings.Join(keys, ","); got != "Hostname,FQDN,IP,Port" {
+			t.Errorf("element fields = %s, want Hostname,FQDN,IP,Port", got)
+		}
+	}
+}
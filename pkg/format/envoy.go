@@ -0,0 +1,128 @@
+package format
+
+import (
+	"encoding/json"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"sigs.k8s.io/yaml"
+)
+
+func init() {
+	Register("envoy-eds", formatEnvoyEDS)
+	Register("envoy-eds-yaml", formatEnvoyEDSYAML)
+}
+
+const clusterLoadAssignmentType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+
+// The types below follow the proto3 JSON mapping of the Envoy v3 API
+type envoyDiscoveryResponse struct {
+	Resources []*envoyClusterLoadAssignment `json:"resources"`
+}
+
+type envoyClusterLoadAssignment struct {
+	Type        string                      `json:"@type"`
+	ClusterName string                      `json:"cluster_name"`
+	Endpoints   []*envoyLocalityLbEndpoints `json:"endpoints"`
+}
+
+type envoyLocality struct {
+	Zone string `json:"zone"`
+}
+
+type envoyLocalityLbEndpoints struct {
+	Locality    *envoyLocality    `json:"locality,omitempty"`
+	LbEndpoints []envoyLbEndpoint `json:"lb_endpoints"`
+}
+
+type envoyLbEndpoint struct {
+	Endpoint     envoyEndpoint `json:"endpoint"`
+	HealthStatus string        `json:"health_status"`
+}
+
+type envoyEndpoint struct {
+	Address  envoyAddress `json:"address"`
+	Hostname string       `json:"hostname,omitempty"`
+}
+
+type envoyAddress struct {
+	SocketAddress envoySocketAddress `json:"socket_address"`
+}
+
+type envoySocketAddress struct {
+	Address   string `json:"address"`
+	PortValue int32  `json:"port_value,omitempty"`
+}
+
+// getEnvoyDiscoveryResponse builds a ClusterLoadAssignment per service, or a single one named
+// EnvoyCluster, with the endpoints grouped by zone into localities
+func getEnvoyDiscoveryResponse(endpoints []discovery.Endpoint, options Options) *envoyDiscoveryResponse {
+	response := &envoyDiscoveryResponse{Resources: []*envoyClusterLoadAssignment{}}
+	byCluster := map[string]*envoyClusterLoadAssignment{}
+	byLocality := map[*envoyClusterLoadAssignment]map[string]*envoyLocalityLbEndpoints{}
+	assignment := func(name string) *envoyClusterLoadAssignment {
+		if cla, ok := byCluster[name]; ok {
+			return cla
+		}
+		cla := &envoyClusterLoadAssignment{
+			Type:        clusterLoadAssignmentType,
+			ClusterName: name,
+			Endpoints:   []*envoyLocalityLbEndpoints{},
+		}
+		byCluster[name] = cla
+		byLocality[cla] = map[string]*envoyLocalityLbEndpoints{}
+		response.Resources = append(response.Resources, cla)
+		return cla
+	}
+	if options.EnvoyCluster != "" {
+		// an empty assignment tells Envoy the cluster has no endpoints left
+		assignment(options.EnvoyCluster)
+	}
+	for _, endpoint := range endpoints {
+		name := options.EnvoyCluster
+		if name == "" {
+			name = endpoint.Service
+		}
+		cla := assignment(name)
+		zoneName := zone(endpoint, options)
+		locality, ok := byLocality[cla][zoneName]
+		if !ok {
+			locality = &envoyLocalityLbEndpoints{LbEndpoints: []envoyLbEndpoint{}}
+			if zoneName != "" {
+				locality.Locality = &envoyLocality{Zone: zoneName}
+			}
+			byLocality[cla][zoneName] = locality
+			cla.Endpoints = append(cla.Endpoints, locality)
+		}
+		healthStatus := "HEALTHY"
+		if !endpoint.Ready {
+			healthStatus = "UNHEALTHY"
+		}
+		locality.LbEndpoints = append(locality.LbEndpoints, envoyLbEndpoint{
+			Endpoint: envoyEndpoint{
+				Address:  envoyAddress{SocketAddress: envoySocketAddress{Address: endpoint.IP, PortValue: endpoint.Port}},
+				Hostname: endpoint.FQDN,
+			},
+			HealthStatus: healthStatus,
+		})
+	}
+	return response
+}
+
+// formatEnvoyEDS renders the endpoints as the JSON DiscoveryResponse of ClusterLoadAssignments
+// read by the filesystem EDS subscriptions of Envoy
+func formatEnvoyEDS(endpoints []discovery.Endpoint, options Options) (string, error) {
+	data, err := json.Marshal(getEnvoyDiscoveryResponse(endpoints, options))
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// formatEnvoyEDSYAML renders the DiscoveryResponse of formatEnvoyEDS as YAML
+func formatEnvoyEDSYAML(endpoints []discovery.Endpoint, options Options) (string, error) {
+	data, err := yaml.Marshal(getEnvoyDiscoveryResponse(endpoints, options))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,49 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+)
+
+// commandTimeout bounds the run of an external format command
+const commandTimeout = 30 * time.Second
+
+// NewCommand returns a formatter running the command, a program followed by its space-separated
+// arguments, with the endpoints of the json format on its stdin and using its stdout as the
+// output. The standard error of the command is passed through.
+func NewCommand(command string) (Formatter, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing command")
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, err
+	}
+	return func(endpoints []discovery.Endpoint, options Options) (string, error) {
+		input, err := json.Marshal(StructuredEndpoints(endpoints, options))
+		if err != nil {
+			return "", err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = bytes.NewReader(append(input, '\n'))
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("format command %s timed out after %s", args[0], commandTimeout)
+		}
+		if err != nil {
+			return "", fmt.Errorf("format command %s failed: %v", args[0], err)
+		}
+		return string(output), nil
+	}, nil
+}
@@ -0,0 +1,224 @@
+/*
+
+Package format renders discovered endpoints in the output formats of the tool.
+
+*/
+
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+)
+
+// Options carries the settings of the individual formats
+type Options struct {
+	GoType string
+	GoVar  string
+	// GoStructured renders the golang format as structs with the Hostname, FQDN, IP and Port fields
+	// of the endpoints instead of strings
+	GoStructured bool
+	// MinimumMasterNodes adds discovery.zen.minimum_master_nodes to the elasticsearch format
+	MinimumMasterNodes bool
+	// OrdinalRegex extracts the ordinal from the hostnames with its first group, the StatefulSet
+	// ordinal when nil
+	OrdinalRegex *regexp.Regexp
+	// IndexOffset is added to the ordinals in the node ids, the zookeeper ids starting at 1 for ordinal 0
+	IndexOffset int
+	// KafkaPort is the controller port of the kafka format, 9093 when zero
+	KafkaPort int32
+	// EtcdScheme and EtcdPeerPort build the peer URLs of the etcd format, http and 2380 when empty
+	EtcdScheme   string
+	EtcdPeerPort int32
+	// VaultScheme and VaultPort build the leader_api_addr of the vault format, https and 8200 when empty
+	VaultScheme string
+	VaultPort   int32
+	// MinioScheme, MinioPort and MinioPath build the server URLs of the minio format, https, 9000
+	// and /data when empty; MinioList lists every server instead of the {x...y} expansion
+	MinioScheme string
+	MinioPort   int32
+	MinioPath   string
+	MinioList   bool
+	// CockroachPort is the port of the cockroachdb format, 26257 when zero, and CockroachJoinLimit
+	// limits its --join list to the lowest ordinals, 0 lists all of them
+	CockroachPort      int32
+	CockroachJoinLimit int
+	// NatsScheme and NatsPort build the cluster routes of the nats format, nats and 6222 when empty
+	NatsScheme string
+	NatsPort   int32
+	// HazelcastPort is the member port of the hazelcast format, 5701 when zero
+	HazelcastPort int32
+	// IgnitePort is the discovery port of the ignite formats, 47500 when zero, and IgnitePortRange
+	// the number of following ports each address also covers
+	IgnitePort      int32
+	IgnitePortRange int
+	// ClickHouseCluster, ClickHouseShards and ClickHousePort set the cluster name, the shard count
+	// and the replica port of the clickhouse format, the service name, 1 and 9000 when empty
+	ClickHouseCluster string
+	ClickHouseShards  int
+	ClickHousePort    int32
+	// RedisPort is the port of the redis formats, 6379 when zero. RedisMaster and RedisQuorum set
+	// the master name and the quorum of the redis-sentinel format, mymaster and the majority of the
+	// endpoints when empty, and RedisClusterReplicas the replicas per master of redis-cluster.
+	RedisPort            int32
+	RedisMaster          string
+	RedisQuorum          int
+	RedisClusterReplicas int
+	// PatroniPort is the DCS port of the patroni format, the endpoint port or 2379 when zero
+	PatroniPort int32
+	// PgHbaMethod is the authentication method of the pg-hba format, md5 when empty
+	PgHbaMethod string
+	// SolrChroot is the ZooKeeper chroot of the solr format, /solr when empty and none when /
+	SolrChroot string
+	// CassandraSeeds limits the cassandra seed list to the first endpoints, 0 lists all of them
+	CassandraSeeds int
+	// MongoReplicaSet is the replica set name of the mongodb format, the service name when empty
+	MongoReplicaSet string
+	// ProxyName and ProxyPort set the backend or upstream name and the server port of the haproxy
+	// and nginx formats, the service name and the endpoint port when empty
+	ProxyName string
+	ProxyPort int32
+	// EnvoyCluster names the single ClusterLoadAssignment of the envoy-eds formats, one per service
+	// named like it when empty
+	EnvoyCluster string
+	// ReadySuffix and NotReadySuffix are appended to the names of the default format and set as
+	// the Readiness of the template endpoints, by the readiness of the endpoint
+	ReadySuffix    string
+	NotReadySuffix string
+	// EnvPrefix starts the variable names of the env format, PEER when empty
+	EnvPrefix string
+	// SelfIP is the IP of the local pod, excluded from peer lists
+	SelfIP string
+	// ResultTTL and GeneratedAt fill the result envelope of the json and yaml formats, the
+	// current time when GeneratedAt is zero
+	ResultTTL   int
+	GeneratedAt time.Time
+	// Zone resolves the availability zone of an endpoint for the zones, json, yaml and envoy-eds
+	// formats and the templates using it
+	Zone func(discovery.Endpoint) string
+}
+
+// Formatter renders the endpoints in a particular output format
+type Formatter func([]discovery.Endpoint, Options) (string, error)
+
+// WriterFormatter writes the endpoints in a particular output format, streaming a large list
+// instead of building it in memory first. Part of the output may have been written when it
+// fails.
+type WriterFormatter func(io.Writer, []discovery.Endpoint, Options) error
+
+var formatters = map[string]Formatter{}
+
+var writers = map[string]WriterFormatter{}
+
+// buffers are reused across the renderings of the writer formatters to strings
+var buffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// Register makes a formatter available under the name, replacing any previous one
+func Register(name string, fn Formatter) {
+	formatters[name] = fn
+	delete(writers, name)
+}
+
+// RegisterWriter makes a writer formatter available under the name, replacing any previous one.
+// Lookup returns it rendering to a string.
+func RegisterWriter(name string, fn WriterFormatter) {
+	writers[name] = fn
+	formatters[name] = func(endpoints []discovery.Endpoint, options Options) (string, error) {
+		b := buffers.Get().(*bytes.Buffer)
+		defer buffers.Put(b)
+		b.Reset()
+		if err := fn(b, endpoints, options); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+}
+
+// Lookup returns the formatter registered under the name
+func Lookup(name string) (Formatter, error) {
+	fn, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q", name)
+	}
+	return fn, nil
+}
+
+// LookupWriter returns the writer formatter registered under the name, or the formatter
+// registered under it writing its rendered output
+func LookupWriter(name string) (WriterFormatter, error) {
+	if fn, ok := writers[name]; ok {
+		return fn, nil
+	}
+	fn, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return func(w io.Writer, endpoints []discovery.Endpoint, options Options) error {
+		output, err := fn(endpoints, options)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, output)
+		return err
+	}, nil
+}
+
+// Quorum returns the majority of the member count
+func Quorum(members int) int {
+	return members/2 + 1
+}
+
+// ordinal returns the ordinal of the endpoint hostname
+func ordinal(endpoint discovery.Endpoint, options Options) (int, error) {
+	ordinal := discovery.ParseOrdinal(endpoint.Hostname, options.OrdinalRegex)
+	if ordinal < 0 {
+		return 0, fmt.Errorf("unable to find the ordinal of endpoint %s in hostname %q", endpoint.FQDN, endpoint.Hostname)
+	}
+	return ordinal, nil
+}
+
+// host returns the emitted name of the endpoint as the host of an address, bracketed when it's
+// an IPv6 literal
+func host(endpoint discovery.Endpoint) string {
+	if strings.Contains(endpoint.FQDN, ":") {
+		return "[" + endpoint.FQDN + "]"
+	}
+	return endpoint.FQDN
+}
+
+// hostPort returns the host:port address of the endpoint
+func hostPort(endpoint discovery.Endpoint, port int32) string {
+	return net.JoinHostPort(endpoint.FQDN, strconv.Itoa(int(port)))
+}
+
+// readiness returns the ReadySuffix or NotReadySuffix of the endpoint
+func readiness(endpoint discovery.Endpoint, options Options) string {
+	if endpoint.Ready {
+		return options.ReadySuffix
+	}
+	return options.NotReadySuffix
+}
+
+// zone returns the availability zone of the endpoint, taken from its EndpointSlice or its node,
+// empty when it has neither or the zone is unknown
+func zone(endpoint discovery.Endpoint, options Options) string {
+	if endpoint.Zone != "" {
+		return endpoint.Zone
+	}
+	if options.Zone == nil || endpoint.NodeName == "" {
+		return ""
+	}
+	if zone := options.Zone(endpoint); zone != "unknown" {
+		return zone
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata with the current output")
+
+// generatedAt stamps the results of the json and yaml formats, so that their output is the same
+// on every run
+var generatedAt = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// goldenCase renders the endpoints in a format and compares the output with testdata/<name>.golden
+type goldenCase struct {
+	name      string
+	format    string
+	endpoints []discovery.Endpoint
+	options   Options
+}
+
+// goldenCases returns a case per registered format, rendering the sample endpoints with the
+// default options, followed by the cases of particular options
+func goldenCases() []goldenCase {
+	names := []string{}
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cases := []goldenCase{}
+	for _, name := range names {
+		cases = append(cases, goldenCase{name: name, format: name, endpoints: SampleEndpoints()})
+	}
+	return append(cases, extraGoldenCases...)
+}
+
+// extraGoldenCases cover the options and inputs the sample endpoints don't
+var extraGoldenCases = []goldenCase{
+	{name: "elasticsearch-minimum-master-nodes", format: "elasticsearch", endpoints: SampleEndpoints(), options: Options{MinimumMasterNodes: true}},
+	{name: "zookeeper-index-offset", format: "zookeeper", endpoints: SampleEndpoints(), options: Options{IndexOffset: 1}},
+	{name: "golang-variable", format: "golang", endpoints: SampleEndpoints(), options: Options{GoVar: "peers"}},
+	{name: "golang-structured", format: "golang", endpoints: SampleEndpoints(), options: Options{GoStructured: true, GoVar: "peers"}},
+	{name: "env-prefix", format: "env", endpoints: SampleEndpoints(), options: Options{EnvPrefix: "ZK"}},
+	{name: "empty-default", format: "default", endpoints: []discovery.Endpoint{}},
+	{name: "default-readiness", format: "default", endpoints: notReadySample(), options: Options{ReadySuffix: " (ready)", NotReadySuffix: " (not-ready)"}},
+	{name: "json-dual-stack", format: "json", endpoints: dualStackSample()},
+	{name: "dual-stack-dual", format: "dual-stack", endpoints: dualStackSample()},
+	// the local node, here the middle one of the three, isn't its own peer
+	{name: "keepalived-exclude-self", format: "keepalived", endpoints: SampleEndpoints(), options: Options{SelfIP: "10.0.0.11"}},
+	{name: "haproxy-ip-hostnames", format: "haproxy", endpoints: ipNamedSample()},
+}
+
+// ipNamedSample returns the sample endpoints without hostnames, as named by the ip hostname
+// source, zk-1 by its IPv6 address, and zk-2 by a load balancer hostname without an IP
+func ipNamedSample() []discovery.Endpoint {
+	endpoints := SampleEndpoints()
+	endpoints[1].IP = "fd00::11"
+	for i := range endpoints {
+		endpoints[i].Hostname, endpoints[i].FQDN = "", endpoints[i].IP
+	}
+	endpoints[2].IP, endpoints[2].FQDN = "", "zk.example.com"
+	return endpoints
+}
+
+// dualStackSample returns the sample endpoints with an IPv6 address besides the IPv4 one, but
+// for zk-2
+func dualStackSample() []discovery.Endpoint {
+	endpoints := SampleEndpoints()
+	for i := range endpoints[:2] {
+		endpoints[i].IPs = []string{endpoints[i].IP, fmt.Sprintf("fd00::%d", 10+i)}
+	}
+	return endpoints
+}
+
+// notReadySample returns the sample endpoints with zk-1 not ready
+func notReadySample() []discovery.Endpoint {
+	endpoints := SampleEndpoints()
+	endpoints[1].Ready = false
+	return endpoints
+}
+
+func TestFormatsGolden(t *testing.T) {
+	for _, c := range goldenCases() {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			formatter, err := Lookup(c.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			options := c.options
+			if options.GeneratedAt.IsZero() {
+				options.GeneratedAt = generatedAt
+			}
+			output, err := formatter(c.endpoints, options)
+			if err != nil {
+				t.Fatalf("rendering %s: %v", c.format, err)
+			}
+			path := filepath.Join("testdata", c.name+".golden")
+			if *update {
+				if err := os.MkdirAll("testdata", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			golden, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v, run go test ./pkg/format -update to create it", err)
+			}
+			if output != string(golden) {
+				t.Errorf("%s output differs from %s:\n--- got\n%s\n--- want\n%s", c.format, path, output, golden)
+			}
+		})
+	}
+}
+
+// TestWriterFormatters checks that the streamed output of every format is its rendered one
+func TestWriterFormatters(t *testing.T) {
+	for name, formatter := range formatters {
+		writer, err := LookupWriter(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rendered, err := formatter(SampleEndpoints(), Options{GeneratedAt: generatedAt})
+		if err != nil {
+			t.Fatalf("rendering %s: %v", name, err)
+		}
+		var streamed bytes.Buffer
+		if err := writer(&streamed, SampleEndpoints(), Options{GeneratedAt: generatedAt}); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+		if streamed.String() != rendered {
+			t.Errorf("%s writes %q, renders %q", name, streamed.String(), rendered)
+		}
+	}
+}
+
+func TestJSONResult(t *testing.T) {
+	// the streamed json output is the encoding of the result envelope
+	for _, endpoints := range [][]discovery.Endpoint{SampleEndpoints(), dualStackSample(), {}} {
+		options := Options{ResultTTL: 30, GeneratedAt: generatedAt}
+		var streamed bytes.Buffer
+		if err := writeJSON(&streamed, endpoints, options); err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := json.Marshal(NewResult(endpoints, options))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := streamed.String(), string(encoded)+"\n"; got != want {
+			t.Errorf("writeJSON() = %s, want %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package format
+
+import (
+	"fmt"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+)
+
+// SampleEndpoints returns the endpoints of a three-member ZooKeeper StatefulSet, zk-0 to zk-2 of
+// the zk-hs service in the default namespace, exposing the client, server and leader-election
+// ports, to render a format or template with outside a cluster
+func SampleEndpoints() []discovery.Endpoint {
+	ports := []discovery.Port{
+		{Name: "client", Port: 2181, Protocol: "TCP"},
+		{Name: "server", Port: 2888, Protocol: "TCP"},
+		{Name: "leader-election", Port: 3888, Protocol: "TCP"},
+	}
+	endpoints := []discovery.Endpoint{}
+	for i := 0; i < 3; i++ {
+		hostname := fmt.Sprintf("zk-%d", i)
+		endpoints = append(endpoints, discovery.Endpoint{
+			Hostname:  hostname,
+			FQDN:      hostname + ".zk-hs.default.svc.cluster.local",
+			IP:        fmt.Sprintf("10.0.0.%d", 10+i),
+			Port:      ports[0].Port,
+			Ports:     ports,
+			NodeName:  fmt.Sprintf("node-%d", i),
+			PodName:   hostname,
+			Namespace: "default",
+			Service:   "zk-hs",
+			Ready:     true,
+		})
+	}
+	return endpoints
+}
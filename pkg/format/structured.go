@@ -0,0 +1,235 @@
+package format
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"sigs.k8s.io/yaml"
+)
+
+func init() {
+	RegisterWriter("json", writeJSON)
+	Register("yaml", formatYAML)
+	RegisterWriter("dual-stack", writeDualStack)
+}
+
+// ResultAPIVersion identifies the schema of the result envelope of the json and yaml formats,
+// shared with the structured result and the webhook payload. Fields are only added within a
+// version; removing or changing a field requires a new version, the prior one staying available.
+const ResultAPIVersion = "endpoint-discovery.io/v1"
+
+// ResultSchema documents the schema of the envelope and its versioning policy, the consumers
+// finding it in every result
+const ResultSchema = "https://github.com/IvanovOleg/kube-endpoint-discovery#structured-result"
+
+// Result is the versioned envelope of the json and yaml formats: the names of the endpoints, as
+// in the structured result, and the endpoint objects as its items
+type Result struct {
+	APIVersion  string               `json:"apiVersion"`
+	Schema      string               `json:"schema"`
+	Kind        string               `json:"kind"`
+	Count       int                  `json:"count"`
+	Endpoints   []string             `json:"endpoints"`
+	Items       []StructuredEndpoint `json:"items"`
+	TTL         int                  `json:"ttl"`
+	GeneratedAt time.Time            `json:"generatedAt"`
+}
+
+// NewResult returns the result envelope of the endpoints
+func NewResult(endpoints []discovery.Endpoint, options Options) Result {
+	result := Result{
+		APIVersion:  ResultAPIVersion,
+		Schema:      ResultSchema,
+		Kind:        "DiscoveryResult",
+		Count:       len(endpoints),
+		Endpoints:   discovery.Names(endpoints),
+		Items:       StructuredEndpoints(endpoints, options),
+		TTL:         options.ResultTTL,
+		GeneratedAt: options.GeneratedAt,
+	}
+	if result.GeneratedAt.IsZero() {
+		result.GeneratedAt = time.Now().UTC()
+	}
+	return result
+}
+
+// StructuredPort is the schema of a port in the json and yaml formats
+type StructuredPort struct {
+	Name     string `json:"name,omitempty"`
+	Port     int32  `json:"port"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// StructuredEndpoint is the schema of an endpoint in the json and yaml formats
+type StructuredEndpoint struct {
+	Hostname string `json:"hostname"`
+	FQDN     string `json:"fqdn"`
+	IP       string `json:"ip"`
+	// IPs are the addresses of every family of a dual-stack endpoint, IP first
+	IPs       []string         `json:"ips,omitempty"`
+	Ports     []StructuredPort `json:"ports"`
+	NodeName  string           `json:"nodeName,omitempty"`
+	Zone      string           `json:"zone,omitempty"`
+	PodName   string           `json:"podName,omitempty"`
+	Namespace string           `json:"namespace"`
+	Service   string           `json:"service"`
+	Ready     bool             `json:"ready"`
+	Cluster   string           `json:"cluster,omitempty"`
+}
+
+// StructuredEndpoints returns the endpoints with the schema of the json and yaml formats
+func StructuredEndpoints(endpoints []discovery.Endpoint, options Options) []StructuredEndpoint {
+	structured := make([]StructuredEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		structured = append(structured, structuredEndpoint(endpoint, options))
+	}
+	return structured
+}
+
+// structuredEndpoint returns the endpoint with the schema of the json and yaml formats
+func structuredEndpoint(endpoint discovery.Endpoint, options Options) StructuredEndpoint {
+	ports := make([]StructuredPort, 0, len(endpoint.Ports))
+	for _, port := range endpoint.Ports {
+		ports = append(ports, StructuredPort{Name: port.Name, Port: port.Port, Protocol: port.Protocol})
+	}
+	var ips []string
+	if len(endpoint.IPs) > 1 {
+		ips = endpoint.IPs
+	}
+	return StructuredEndpoint{
+		Hostname:  endpoint.Hostname,
+		FQDN:      endpoint.FQDN,
+		IP:        endpoint.IP,
+		IPs:       ips,
+		Ports:     ports,
+		NodeName:  endpoint.NodeName,
+		Zone:      zone(endpoint, options),
+		PodName:   endpoint.PodName,
+		Namespace: endpoint.Namespace,
+		Service:   endpoint.Service,
+		Ready:     endpoint.Ready,
+		Cluster:   endpoint.Cluster,
+	}
+}
+
+// writeJSON writes the result envelope of the endpoints, encoding one item at a time, with the
+// same fields in the same order as the encoding of a Result
+func writeJSON(w io.Writer, endpoints []discovery.Endpoint, options Options) error {
+	envelope := NewResult(nil, options)
+	envelope.Count, envelope.Endpoints = len(endpoints), discovery.Names(endpoints)
+	b := bufio.NewWriter(w)
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{`{"apiVersion":`, envelope.APIVersion},
+		{`,"schema":`, envelope.Schema},
+		{`,"kind":`, envelope.Kind},
+		{`,"count":`, envelope.Count},
+		{`,"endpoints":`, envelope.Endpoints},
+	}
+	for _, field := range fields {
+		data, err := json.Marshal(field.value)
+		if err != nil {
+			return err
+		}
+		b.WriteString(field.name)
+		b.Write(data)
+	}
+	b.WriteString(`,"items":[`)
+	for i, endpoint := range endpoints {
+		data, err := json.Marshal(structuredEndpoint(endpoint, options))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(data)
+	}
+	generatedAt, err := json.Marshal(envelope.GeneratedAt)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b, `],"ttl":%d,"generatedAt":%s}`+"\n", envelope.TTL, generatedAt)
+	return b.Flush()
+}
+
+// formatYAML renders the result envelope of the endpoints as YAML
+func formatYAML(endpoints []discovery.Endpoint, options Options) (string, error) {
+	data, err := yaml.Marshal(NewResult(endpoints, options))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DualStackEndpoint is the schema of an endpoint in the dual-stack format, the addresses of a pod
+// in both families for happy-eyeballs clients to race
+type DualStackEndpoint struct {
+	// TargetRef is the namespace/name of the pod of the addresses, empty when they don't target one
+	TargetRef string `json:"targetRef,omitempty"`
+	FQDN      string `json:"fqdn"`
+	IPv4      string `json:"ipv4,omitempty"`
+	IPv6      string `json:"ipv6,omitempty"`
+	Port      int32  `json:"port,omitempty"`
+	// Addresses are the host:port addresses to connect to, or the IPs without a port, IPv6 first
+	Addresses []string `json:"addresses"`
+	Ready     bool     `json:"ready"`
+}
+
+// dualStackEndpoint returns the endpoint with the schema of the dual-stack format
+func dualStackEndpoint(endpoint discovery.Endpoint) DualStackEndpoint {
+	structured := DualStackEndpoint{FQDN: endpoint.FQDN, Port: endpoint.Port, Addresses: []string{}, Ready: endpoint.Ready}
+	if endpoint.PodName != "" {
+		structured.TargetRef = endpoint.Namespace + "/" + endpoint.PodName
+	}
+	ips := endpoint.IPs
+	if len(ips) == 0 && endpoint.IP != "" {
+		ips = []string{endpoint.IP}
+	}
+	for _, ip := range ips {
+		if strings.Contains(ip, ":") {
+			structured.IPv6 = ip
+		} else {
+			structured.IPv4 = ip
+		}
+	}
+	// RFC 8305 clients start with IPv6
+	for _, ip := range []string{structured.IPv6, structured.IPv4} {
+		switch {
+		case ip == "":
+		case endpoint.Port != 0:
+			structured.Addresses = append(structured.Addresses, net.JoinHostPort(ip, strconv.Itoa(int(endpoint.Port))))
+		default:
+			structured.Addresses = append(structured.Addresses, ip)
+		}
+	}
+	return structured
+}
+
+// writeDualStack writes the endpoints as a JSON array with the addresses of each pod in both
+// families, encoding one endpoint at a time
+func writeDualStack(w io.Writer, endpoints []discovery.Endpoint, options Options) error {
+	b := bufio.NewWriter(w)
+	b.WriteByte('[')
+	for i, endpoint := range endpoints {
+		data, err := json.Marshal(dualStackEndpoint(endpoint))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(data)
+	}
+	b.WriteString("]\n")
+	return b.Flush()
+}
@@ -0,0 +1,147 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+)
+
+// TemplateEndpoint is an endpoint as seen by an output template
+type TemplateEndpoint struct {
+	Hostname string
+	FQDN     string
+	// Host is FQDN bracketed when it's an IPv6 literal, ready to be followed by :<port>
+	Host string
+	IP   string
+	// IPs are the addresses of every family of a dual-stack endpoint, IP first
+	IPs  []string
+	Port int32
+	// Ports maps the port names of the endpoint to their numbers, an unnamed port has an empty name
+	Ports map[string]int32
+	// Index is the ordinal of the endpoint, -1 when the hostname has none
+	Index    int
+	NodeName string
+	PodName  string
+	Ready    bool
+	// Readiness is the ReadySuffix or NotReadySuffix of the endpoint
+	Readiness string
+	Namespace string
+	Service   string
+
+	endpoint discovery.Endpoint
+	options  Options
+}
+
+// endpointIPs returns the addresses of the endpoint, for the endpoints built without IPs too
+func endpointIPs(endpoint discovery.Endpoint) []string {
+	if len(endpoint.IPs) == 0 && endpoint.IP != "" {
+		return []string{endpoint.IP}
+	}
+	return endpoint.IPs
+}
+
+// Zone returns the availability zone of the node of the endpoint, resolved only when the
+// template uses it
+func (e TemplateEndpoint) Zone() string {
+	return zone(e.endpoint, e.options)
+}
+
+// TemplateData is the value an output template is executed with
+type TemplateData struct {
+	Endpoints []TemplateEndpoint
+	// Services holds the endpoints of each service by name
+	Services map[string][]TemplateEndpoint
+	Count    int
+	// Quorum is the majority of Count
+	Quorum int
+}
+
+// templatePort returns the port function of the templates executed over the endpoints.
+// {{port "peer"}} returns the number of the port of the service with the name, the one all the
+// endpoints expose it on, and {{port "peer" .}} the one of the endpoint in a range. Both fail the
+// rendering when there's no such port.
+func templatePort(endpoints []TemplateEndpoint) func(string, ...TemplateEndpoint) (int32, error) {
+	return func(name string, endpoint ...TemplateEndpoint) (int32, error) {
+		if len(endpoint) > 1 {
+			return 0, fmt.Errorf("port %q takes at most one endpoint", name)
+		}
+		if len(endpoint) == 1 {
+			port, ok := endpoint[0].Ports[name]
+			if !ok {
+				return 0, fmt.Errorf("endpoint %s has no port named %q", endpoint[0].FQDN, name)
+			}
+			return port, nil
+		}
+		found := false
+		var number int32
+		for _, endpoint := range endpoints {
+			port, ok := endpoint.Ports[name]
+			if !ok {
+				continue
+			}
+			if found && port != number {
+				return 0, fmt.Errorf("the endpoints expose the port named %q on both %d and %d, use {{port %q .}} in a range", name, number, port, name)
+			}
+			found, number = true, port
+		}
+		if !found {
+			return 0, fmt.Errorf("no endpoint has a port named %q", name)
+		}
+		return number, nil
+	}
+}
+
+// NewTemplate parses a text/template and returns a formatter executing it over the endpoints
+func NewTemplate(text string) (Formatter, error) {
+	tmpl, err := template.New("output").Funcs(template.FuncMap{"port": templatePort(nil)}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(endpoints []discovery.Endpoint, options Options) (string, error) {
+		data := TemplateData{
+			Endpoints: []TemplateEndpoint{},
+			Services:  map[string][]TemplateEndpoint{},
+			Count:     len(endpoints),
+			Quorum:    Quorum(len(endpoints)),
+		}
+		for _, endpoint := range endpoints {
+			ports := map[string]int32{}
+			for _, port := range endpoint.Ports {
+				ports[port.Name] = port.Port
+			}
+			templateEndpoint := TemplateEndpoint{
+				Hostname:  endpoint.Hostname,
+				FQDN:      endpoint.FQDN,
+				Host:      host(endpoint),
+				IP:        endpoint.IP,
+				IPs:       endpointIPs(endpoint),
+				Port:      endpoint.Port,
+				Ports:     ports,
+				Index:     discovery.ParseOrdinal(endpoint.Hostname, options.OrdinalRegex),
+				NodeName:  endpoint.NodeName,
+				PodName:   endpoint.PodName,
+				Ready:     endpoint.Ready,
+				Readiness: readiness(endpoint, options),
+				Namespace: endpoint.Namespace,
+				Service:   endpoint.Service,
+				endpoint:  endpoint,
+				options:   options,
+			}
+			data.Endpoints = append(data.Endpoints, templateEndpoint)
+			data.Services[endpoint.Service] = append(data.Services[endpoint.Service], templateEndpoint)
+		}
+		// the port function of a clone sees the endpoints, the template being shared by the renderings
+		execution, err := tmpl.Clone()
+		if err != nil {
+			return "", err
+		}
+		execution.Funcs(template.FuncMap{"port": templatePort(data.Endpoints)})
+		var b strings.Builder
+		if err := execution.Execute(&b, data); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}, nil
+}
@@ -0,0 +1,80 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+)
+
+func TestTemplateReadiness(t *testing.T) {
+	formatter, err := NewTemplate(`{{range .Endpoints}}{{.Hostname}}{{.Readiness}};{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name    string
+		options Options
+		want    string
+	}{
+		{"off", Options{}, "zk-0;zk-1;zk-2;"},
+		{"suffixes", Options{ReadySuffix: "+", NotReadySuffix: "-"}, "zk-0+;zk-1-;zk-2+;"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			output, err := formatter(notReadySample(), c.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != c.want {
+				t.Errorf("output = %q, want %q", output, c.want)
+			}
+		})
+	}
+}
+
+func TestTemplatePort(t *testing.T) {
+	endpoints := SampleEndpoints()
+	for _, c := range []struct {
+		name     string
+		template string
+		want     string
+		fails    bool
+	}{
+		{"service", `{{range .Endpoints}}{{.Hostname}}:{{port "client"}};{{end}}`, "zk-0:2181;zk-1:2181;zk-2:2181;", false},
+		{"endpoint", `{{range .Endpoints}}{{.Hostname}}:{{port "client" .}};{{end}}`, "zk-0:2181;zk-1:2181;zk-2:2181;", false},
+		{"outside a range", `{{port "client"}}`, "2181", false},
+		{"unknown", `{{port "admin"}}`, "", true},
+		{"unknown of the endpoint", `{{range .Endpoints}}{{port "admin" .}}{{end}}`, "", true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			formatter, err := NewTemplate(c.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := formatter(endpoints, Options{})
+			if c.fails {
+				if err == nil {
+					t.Errorf("output = %q, want an error", output)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != c.want {
+				t.Errorf("output = %q, want %q", output, c.want)
+			}
+		})
+	}
+}
+
+func TestTemplatePortDiffering(t *testing.T) {
+	endpoints := SampleEndpoints()
+	endpoints[2].Ports = append([]discovery.Port{{Name: "client", Port: 2182, Protocol: "TCP"}}, endpoints[2].Ports[1:]...)
+	formatter, err := NewTemplate(`{{port "client"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output, err := formatter(endpoints, Options{}); err == nil {
+		t.Errorf("output = %q, want an error for the port on two numbers", output)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+
+Package log is the leveled, structured logger of the tool. Messages are written to stderr
+as text or JSON lines, with optional key-value attributes.
+
+*/
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// Setup configures the minimum level (debug, info, warn or error) and the format (text or json)
+// of the messages written to w
+func Setup(w io.Writer, level string, format string) error {
+	if level == "" {
+		level = "info"
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: must be debug, info, warn or error", level)
+	}
+	options := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "", "text":
+		logger = slog.New(slog.NewTextHandler(w, options))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(w, options))
+	default:
+		return fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+	return nil
+}
+
+// Debug logs a message with key-value attributes at the debug level
+func Debug(msg string, args ...interface{}) {
+	logger.Debug(msg, args...)
+}
+
+// Info logs a message with key-value attributes at the info level
+func Info(msg string, args ...interface{}) {
+	logger.Info(msg, args...)
+}
+
+// Warn logs a message with key-value attributes at the warn level
+func Warn(msg string, args ...interface{}) {
+	logger.Warn(msg, args...)
+}
+
+// Error logs a message with key-value attributes at the error level
+func Error(msg string, args ...interface{}) {
+	logger.Error(msg, args...)
+}
+
+// Infof logs a formatted message at the info level
+func Infof(format string, args ...interface{}) {
+	logger.Info(fmt.Sprintf(format, args...))
+}
+
+// Warningf logs a formatted message at the warn level
+func Warningf(format string, args ...interface{}) {
+	logger.Warn(fmt.Sprintf(format, args...))
+}
+
+// Errorf logs a formatted message at the error level
+func Errorf(format string, args ...interface{}) {
+	logger.Error(fmt.Sprintf(format, args...))
+}
+
+// Fatalf logs a formatted message at the error level and exits with status 1
+func Fatalf(format string, args ...interface{}) {
+	logger.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
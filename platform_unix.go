@@ -0,0 +1,51 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reloadSignals are the signals accepted by -reload-signal
+var reloadSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+	"INT":  syscall.SIGINT,
+}
+
+// signalProcess sends the signal to the process
+func signalProcess(pid int, signal syscall.Signal) error {
+	return syscall.Kill(pid, signal)
+}
+
+// replaceProcess replaces the process with the program
+func replaceProcess(path string, argv []string, env []string) error {
+	return syscall.Exec(path, argv, env)
+}
+
+// fdWritable reports whether the file descriptor was opened for writing
+func fdWritable(f *os.File) (bool, error) {
+	flags, err := unix.FcntlInt(f.Fd(), unix.F_GETFL, 0)
+	if err != nil {
+		return false, err
+	}
+	mode := flags & unix.O_ACCMODE
+	return mode == unix.O_WRONLY || mode == unix.O_RDWR, nil
+}
+
+// replaceFile renames the file over the target, atomically for the readers of the target
+func replaceFile(path string, target string) error {
+	return os.Rename(path, target)
+}
+
+// shellCommand returns the command running the command line through the shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
@@ -0,0 +1,139 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFdWritable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		flag int
+		want bool
+	}{
+		{"read-only", os.O_RDONLY, false},
+		{"write-only", os.O_WRONLY, true},
+		{"read-write", os.O_RDWR, true},
+	} {
+		f, err := os.OpenFile(path, c.flag, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writable, err := fdWritable(f)
+		f.Close()
+		if err != nil || writable != c.want {
+			t.Errorf("%s: fdWritable = %t, %v, want %t", c.name, writable, err, c.want)
+		}
+	}
+}
+
+func TestOpenResultFdReadOnly(t *testing.T) {
+	if value := os.Getenv("ENDPOINT_RESULT_FD"); value != "" {
+		// the child process, exiting in openResultFd
+		openResultFd(value)
+		return
+	}
+	path := filepath.Join(t.TempDir(), "result")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// the first of the extra files is the descriptor 3 of the child, as with 3<file
+	cmd := exec.Command(os.Args[0], "-test.run=^TestOpenResultFdReadOnly$")
+	cmd.Env = append(os.Environ(), "ENDPOINT_RESULT_FD=3")
+	cmd.ExtraFiles = []*os.File{f}
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("openResultFd of a read-only descriptor = %v, want exit 1:\n%s", err, output.String())
+	}
+	if !bytes.Contains(output.Bytes(), []byte("not open for writing")) {
+		t.Errorf("openResultFd of a read-only descriptor logged:\n%s", output.String())
+	}
+}
+
+func TestReplaceProcess(t *testing.T) {
+	if os.Getenv("TEST_REPLACE_PROCESS") != "" {
+		// the child process, replaced by the shell
+		err := replaceProcess("/bin/sh", []string{"sh", "-c", "echo replaced $ENDPOINTS; exit 3"}, []string{"ENDPOINTS=zk-0,zk-1"})
+		t.Fatalf("replaceProcess returned: %v", err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestReplaceProcess$")
+	cmd.Env = append(os.Environ(), "TEST_REPLACE_PROCESS=1")
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("replaced process = %v, want exit 3", err)
+	}
+	// the test binary doesn't print its PASS line, the process being replaced
+	if got := strings.TrimSpace(string(output)); got != "replaced zk-0,zk-1" {
+		t.Errorf("replaced process output = %q, want the program's with its environment", got)
+	}
+}
+
+func TestSignalProcess(t *testing.T) {
+	for _, name := range []string{"HUP", "USR1", "USR2", "TERM", "INT"} {
+		if _, ok := reloadSignals[name]; !ok {
+			t.Errorf("reloadSignals has no %s", name)
+		}
+	}
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, syscall.SIGUSR1)
+	defer signal.Stop(received)
+	if err := signalProcess(os.Getpid(), reloadSignals["USR1"]); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Error("SIGUSR1 not received")
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	path, target := filepath.Join(dir, "new"), filepath.Join(dir, "servers.cfg")
+	if err := os.WriteFile(target, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a reader keeps the file it opened, and the next open gets the new one
+	reader, err := os.Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if err := os.WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceFile(path, target); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Errorf("target = %q, want the new content", data)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	output, err := shellCommand(context.Background(), "echo $0 | grep -c sh; exit 0").Output()
+	if err != nil || strings.TrimSpace(string(output)) != "1" {
+		t.Errorf("shellCommand output = %q, %v, want the command run by the shell", output, err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// reloadSignals are the signals accepted by -reload-signal, none on Windows where processes
+// can't be signalled
+var reloadSignals = map[string]syscall.Signal{}
+
+// replaceRetries bounds the attempts to rename a file over a target opened by a reader
+const replaceRetries = 10
+
+// signalProcess fails, processes can't be signalled on Windows
+func signalProcess(pid int, signal syscall.Signal) error {
+	return errors.New("signals aren't supported on Windows")
+}
+
+// replaceProcess runs the program, Windows having no exec, and exits with its exit code once
+// it's done
+func replaceProcess(path string, argv []string, env []string) error {
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+	os.Exit(cmd.ProcessState.ExitCode())
+	return nil
+}
+
+// fdWritable reports the handle as writable, its access mode not being queryable on Windows, so
+// that a read-only handle fails on the first write of the result instead
+func fdWritable(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// replaceFile renames the file over the target, retrying while a reader holds the target open
+func replaceFile(path string, target string) error {
+	var err error
+	for attempt := 0; attempt < replaceRetries; attempt++ {
+		if err = os.Rename(path, target); err == nil || !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
+
+// shellCommand returns the command running the command line through cmd.exe
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFdWritable(t *testing.T) {
+	f, err := os.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// the access mode isn't queried, a read-only handle failing on the first write instead
+	if writable, err := fdWritable(f); err != nil || !writable {
+		t.Errorf("fdWritable = %t, %v, want true", writable, err)
+	}
+}
+
+func TestReplaceProcess(t *testing.T) {
+	if os.Getenv("TEST_REPLACE_PROCESS") != "" {
+		// the child process, exiting with the code of the program it runs
+		err := replaceProcess(os.Getenv("ComSpec"), []string{"cmd", "/C", "echo replaced %ENDPOINTS%& exit 3"}, append(os.Environ(), "ENDPOINTS=zk-0,zk-1"))
+		t.Fatalf("replaceProcess returned: %v", err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestReplaceProcess$")
+	cmd.Env = append(os.Environ(), "TEST_REPLACE_PROCESS=1")
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("replaced process = %v, want exit 3", err)
+	}
+	if got := strings.TrimSpace(string(output)); got != "replaced zk-0,zk-1" {
+		t.Errorf("replaced process output = %q, want the program's with its environment", got)
+	}
+}
+
+func TestSignalProcess(t *testing.T) {
+	if len(reloadSignals) != 0 {
+		t.Errorf("reloadSignals = %v, want none", reloadSignals)
+	}
+	if err := signalProcess(os.Getpid(), syscall.SIGTERM); err == nil {
+		t.Error("signalProcess succeeded, want an error")
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	path, target := filepath.Join(dir, "new"), filepath.Join(dir, "servers.cfg")
+	if err := os.WriteFile(target, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a reader holding the target open makes the rename fail until it closes it
+	reader, err := os.Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		reader.Close()
+	}()
+	if err := os.WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceFile(path, target); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Errorf("target = %q, want the new content", data)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	output, err := shellCommand(context.Background(), "echo hi& exit 0").Output()
+	if err != nil || strings.TrimSpace(string(output)) != "hi" {
+		t.Errorf("shellCommand output = %q, %v, want the command run by cmd.exe", output, err)
+	}
+}
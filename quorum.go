@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// quorumAdvice describes the majority needed by a consensus system of the discovered size
+type quorumAdvice struct {
+	Members int  `json:"members"`
+	Quorum  int  `json:"quorum"`
+	Healthy bool `json:"healthy"`
+}
+
+// getQuorumAdvice computes the majority threshold for the member count. The quorum is
+// considered healthy when the count is odd and at least the expected minimum.
+func getQuorumAdvice(members int, minimum int) *quorumAdvice {
+	return &quorumAdvice{
+		Members: members,
+		Quorum:  format.Quorum(members),
+		Healthy: members > 0 && members%2 == 1 && members >= minimum,
+	}
+}
+
+// logQuorumAdvice logs the recommended quorum and warns about unsafe member counts
+func logQuorumAdvice(advice *quorumAdvice, minimum int) {
+	log.Infof("Quorum advice: %d members need a majority of %d and tolerate %d failures",
+		advice.Members, advice.Quorum, advice.Members-advice.Quorum)
+	if advice.Members%2 == 0 {
+		log.Warningf("Quorum advice: an even member count (%d) tolerates no more failures than %d members", advice.Members, advice.Members-1)
+	}
+	if advice.Members < minimum {
+		log.Warningf("Quorum advice: %d members is below the expected minimum of %d", advice.Members, minimum)
+	}
+}
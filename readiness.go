@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+var readinessGate = flag.String("readiness-gate", os.Getenv("ENDPOINT_READINESS_GATE"), "pod condition set to True on the local pod, POD_NAME in POD_NAMESPACE, once the expected endpoints are found, for a readinessGate of the pod (env ENDPOINT_READINESS_GATE)")
+
+// readinessCondition is the condition of a pod readinessGate set once discovery succeeds
+type readinessCondition struct {
+	conditionType string
+	namespaceName string
+	podName       string
+	set           bool
+}
+
+// newReadinessCondition returns the condition of the local pod: POD_NAME, or the hostname, in
+// POD_NAMESPACE, or the namespace of the services
+func newReadinessCondition(conditionType string, namespaceName string) *readinessCondition {
+	r := &readinessCondition{conditionType: conditionType, namespaceName: os.Getenv("POD_NAMESPACE"), podName: os.Getenv("POD_NAME")}
+	if r.namespaceName == "" {
+		r.namespaceName = namespaceName
+	}
+	if r.podName == "" {
+		var err error
+		if r.podName, err = os.Hostname(); err != nil {
+			log.Fatalf("Unable to get the hostname of the pod for -readiness-gate: %v", err)
+		}
+	}
+	return r
+}
+
+// update sets the condition to True the first time the result meets the expected count
+func (r *readinessCondition) update(ctx context.Context, clientset kubernetes.Interface, result *discovery.Result) {
+	if r.set || result.Err != nil || !result.Met {
+		return
+	}
+	// the conditions are merged by type, leaving the ones of the kubelet untouched
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []core.PodCondition{{
+				Type:               core.PodConditionType(r.conditionType),
+				Status:             core.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(time.Now()),
+				Reason:             "EndpointsDiscovered",
+				Message:            fmt.Sprintf("Discovered %d endpoints", len(result.Endpoints)),
+			}},
+		},
+	})
+	if err != nil {
+		log.Errorf("Unable to encode the %s condition: %v", r.conditionType, err)
+		return
+	}
+	_, err = clientset.CoreV1().Pods(r.namespaceName).Patch(ctx, r.podName, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	if errors.IsForbidden(err) {
+		log.Fatalf("Setting the %s condition is forbidden, grant patch on pods/status in %s: %v", r.conditionType, r.namespaceName, err)
+	}
+	if err != nil {
+		log.Errorf("Unable to set the %s condition of pod %s/%s: %v", r.conditionType, r.namespaceName, r.podName, err)
+		return
+	}
+	log.Infof("Set the %s condition of pod %s/%s", r.conditionType, r.namespaceName, r.podName)
+	r.set = true
+}
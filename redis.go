@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// redisPublisher publishes the rendered output into a Redis key from a background goroutine,
+// so that a slow or unavailable Redis never blocks discovery.
+type redisPublisher struct {
+	address  string
+	password string
+	db       int
+	key      string
+	mode     string
+	updates  chan redisUpdate
+	done     chan struct{}
+}
+
+type redisUpdate struct {
+	output string
+	hosts  []string
+}
+
+// newRedisPublisher parses a redis://[:password@]host[:port][/db] URL and starts the publisher
+func newRedisPublisher(rawURL string, key string, mode string) *redisPublisher {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		log.Fatalf("Invalid ENDPOINT_REDIS_URL %q: must be redis://[:password@]host[:port][/db]", rawURL)
+	}
+	if key == "" {
+		log.Fatalf("ENDPOINT_REDIS_KEY is required when ENDPOINT_REDIS_URL is set")
+	}
+	if mode == "" {
+		mode = "set"
+	}
+	if mode != "set" && mode != "list" {
+		log.Fatalf("Invalid ENDPOINT_REDIS_MODE %q: must be set or list", mode)
+	}
+	p := &redisPublisher{
+		address: u.Host,
+		key:     key,
+		mode:    mode,
+		updates: make(chan redisUpdate, 1),
+		done:    make(chan struct{}),
+	}
+	if u.Port() == "" {
+		p.address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		p.password, _ = u.User.Password()
+		if p.password == "" {
+			p.password = u.User.Username()
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if p.db, err = strconv.Atoi(db); err != nil {
+			log.Fatalf("Invalid ENDPOINT_REDIS_URL database %q", db)
+		}
+	}
+	go p.run()
+	return p
+}
+
+// publish queues the output, replacing any update that hasn't been sent yet
+func (p *redisPublisher) publish(output string, hosts []string) {
+	update := redisUpdate{output: output, hosts: hosts}
+	for {
+		select {
+		case p.updates <- update:
+			return
+		default:
+			select {
+			case <-p.updates:
+			default:
+			}
+		}
+	}
+}
+
+// close waits for the queued update to be published
+func (p *redisPublisher) close() {
+	close(p.updates)
+	<-p.done
+}
+
+func (p *redisPublisher) run() {
+	defer close(p.done)
+	for update := range p.updates {
+		for attempt := 1; attempt <= 5; attempt++ {
+			err := p.send(update)
+			if err == nil {
+				log.Infof("Published endpoints to redis key %s", p.key)
+				break
+			}
+			log.Warningf("Unable to publish to redis (attempt %d): %v", attempt, err)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+}
+
+// send writes a single update over a fresh connection
+func (p *redisPublisher) send(update redisUpdate) error {
+	conn, err := net.DialTimeout("tcp", p.address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+
+	commands := [][]string{}
+	if p.password != "" {
+		commands = append(commands, []string{"AUTH", p.password})
+	}
+	if p.db != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(p.db)})
+	}
+	if p.mode == "list" {
+		commands = append(commands, []string{"MULTI"}, []string{"DEL", p.key})
+		if len(update.hosts) > 0 {
+			commands = append(commands, append([]string{"RPUSH", p.key}, update.hosts...))
+		}
+		commands = append(commands, []string{"EXEC"})
+	} else {
+		commands = append(commands, []string{"SET", p.key, update.output})
+	}
+	for _, command := range commands {
+		if err := writeRedisCommand(conn, command); err != nil {
+			return err
+		}
+		if err := readRedisReply(r); err != nil {
+			return fmt.Errorf("%s: %v", command[0], err)
+		}
+	}
+	return nil
+}
+
+// writeRedisCommand encodes the command as a RESP array of bulk strings
+func writeRedisCommand(w io.Writer, args []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// readRedisReply consumes one RESP reply and returns any error reply it contains
+func readRedisReply(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return fmt.Errorf("empty reply")
+	}
+	switch line[0] {
+	case '-':
+		return fmt.Errorf("%s", line[1:])
+	case '+', ':':
+		return nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		if n >= 0 {
+			_, err = io.CopyN(io.Discard, r, int64(n)+2)
+		}
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := readRedisReply(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unexpected reply %q", line)
+}
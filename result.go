@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// result is the structured discovery result written to ENDPOINT_RESULT_FD, the format.Result
+// envelope of the json and yaml formats with the quorum advice and the partial flag
+type result struct {
+	APIVersion  string                      `json:"apiVersion"`
+	Schema      string                      `json:"schema"`
+	Kind        string                      `json:"kind"`
+	Count       int                         `json:"count"`
+	Endpoints   []string                    `json:"endpoints"`
+	Items       []format.StructuredEndpoint `json:"items"`
+	Quorum      *quorumAdvice               `json:"quorum,omitempty"`
+	Partial     bool                        `json:"partial,omitempty"`
+	TTL         int                         `json:"ttl"`
+	GeneratedAt time.Time                   `json:"generatedAt"`
+}
+
+// openResultFd validates that the numeric file descriptor is open for writing and returns it as a
+// file
+func openResultFd(value string) *os.File {
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		log.Fatalf("Invalid ENDPOINT_RESULT_FD %q: must be a file descriptor number", value)
+	}
+	f := os.NewFile(uintptr(fd), "fd"+value)
+	if f == nil {
+		log.Fatalf("Invalid ENDPOINT_RESULT_FD %q", value)
+	}
+	if _, err := f.Stat(); err != nil {
+		log.Fatalf("ENDPOINT_RESULT_FD %s is not an open file descriptor: %v", value, err)
+	}
+	writable, err := fdWritable(f)
+	if err != nil {
+		log.Fatalf("Unable to get the access mode of ENDPOINT_RESULT_FD %s: %v", value, err)
+	}
+	if !writable {
+		log.Fatalf("ENDPOINT_RESULT_FD %s is not open for writing, e.g. redirect it with %s>file rather than %s<file", value, value, value)
+	}
+	return f
+}
+
+// resultTTL returns the seconds the result can be cached, the longest delay before the endpoints
+// are read again: -max-interval when the wait loop backs off up to it, or in -watch and -hold
+// mode, where changes are emitted as they happen, the -interval of the DNS polls and watch
+// reconnects, or the -write-debounce when it rate limits the emits for longer.
+func resultTTL(watching bool, interval, maxInterval, writeDebounce time.Duration) int {
+	refresh := maxInterval
+	if watching {
+		refresh = interval
+		if writeDebounce > refresh {
+			refresh = writeDebounce
+		}
+	}
+	// rounded up, a sub-second interval still being cacheable for a second
+	return int((refresh + time.Second - 1) / time.Second)
+}
+
+// encodeResult encodes the endpoints as a JSON result, with the version and ttl of the options.
+// The ttl tells caching consumers how many seconds the list can be used before it should be refreshed.
+func encodeResult(endpoints []discovery.Endpoint, options format.Options, advice *quorumAdvice, partial bool) []byte {
+	envelope := format.NewResult(endpoints, options)
+	data, err := json.Marshal(result{
+		APIVersion:  envelope.APIVersion,
+		Schema:      envelope.Schema,
+		Kind:        envelope.Kind,
+		Count:       envelope.Count,
+		Endpoints:   envelope.Endpoints,
+		Items:       envelope.Items,
+		Quorum:      advice,
+		Partial:     partial,
+		TTL:         envelope.TTL,
+		GeneratedAt: envelope.GeneratedAt,
+	})
+	if err != nil {
+		log.Fatalf("Unable to encode the result: %v", err)
+	}
+	return data
+}
+
+// writeResult writes the endpoints as a JSON line to the result file descriptor
+func writeResult(f *os.File, endpoints []discovery.Endpoint, options format.Options, advice *quorumAdvice, partial bool) {
+	data := encodeResult(endpoints, options, advice, partial)
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Fatalf("Unable to write the result to %s: %v", f.Name(), err)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultTTL(t *testing.T) {
+	tests := []struct {
+		name          string
+		watching      bool
+		interval      time.Duration
+		maxInterval   time.Duration
+		writeDebounce time.Duration
+		want          int
+	}{
+		{"wait loop backoff", false, 2 * time.Second, 30 * time.Second, 0, 30},
+		{"watch interval", true, 2 * time.Second, 30 * time.Second, 0, 2},
+		{"watch write debounce", true, 2 * time.Second, 30 * time.Second, time.Minute, 60},
+		{"rounded up", true, 1500 * time.Millisecond, 30 * time.Second, 0, 2},
+		{"sub-second", true, 100 * time.Millisecond, time.Second, 0, 1},
+	}
+	for _, test := range tests {
+		if got := resultTTL(test.watching, test.interval, test.maxInterval, test.writeDebounce); got != test.want {
+			t.Errorf("%s: resultTTL = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
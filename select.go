@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math/rand"
+	"regexp"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+)
+
+// selectEndpoints returns a copy of the result keeping at most limit endpoints after the first
+// skip ones, a zero limit keeping all of them
+func selectEndpoints(result *discovery.Result, skip int, limit int) *discovery.Result {
+	selected := *result
+	endpoints := result.Endpoints
+	if skip > len(endpoints) {
+		skip = len(endpoints)
+	}
+	endpoints = endpoints[skip:]
+	if limit > 0 && limit < len(endpoints) {
+		endpoints = endpoints[:limit]
+	}
+	selected.Endpoints = endpoints
+	return &selected
+}
+
+// endpointPicker selects a single endpoint of the result: the first in the -sort order, the one
+// with the lowest ordinal, or a random one kept for as long as it remains discovered
+type endpointPicker struct {
+	mode         string
+	ordinalRegex *regexp.Regexp
+	picked       string
+}
+
+// pick returns a copy of the result keeping only the picked endpoint
+func (p *endpointPicker) pick(result *discovery.Result) *discovery.Result {
+	picked := *result
+	picked.Endpoints = []discovery.Endpoint{}
+	if len(result.Endpoints) == 0 {
+		return &picked
+	}
+	chosen := result.Endpoints[0]
+	switch p.mode {
+	case "lowest-ordinal":
+		lowest := -1
+		for _, endpoint := range result.Endpoints {
+			// the endpoints without an ordinal are only picked when none has one
+			if ordinal := discovery.ParseOrdinal(endpoint.Hostname, p.ordinalRegex); ordinal >= 0 && (lowest < 0 || ordinal < lowest) {
+				chosen, lowest = endpoint, ordinal
+			}
+		}
+	case "random":
+		chosen = result.Endpoints[rand.Intn(len(result.Endpoints))]
+		for _, endpoint := range result.Endpoints {
+			if endpoint.FQDN == p.picked {
+				chosen = endpoint
+			}
+		}
+	}
+	p.picked = chosen.FQDN
+	picked.Endpoints = []discovery.Endpoint{chosen}
+	return &picked
+}
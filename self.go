@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// selfHostname returns the hostname of the local pod from HOSTNAME, falling back to the kernel
+func selfHostname() string {
+	if hostname := os.Getenv("HOSTNAME"); hostname != "" {
+		return hostname
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("Unable to get the hostname to exclude: %v", err)
+	}
+	return hostname
+}
+
+// withoutSelf returns a copy of the result without the endpoint of the local pod, matched by
+// hostname or by IP
+func withoutSelf(result *discovery.Result, hostname string, ip string) *discovery.Result {
+	filtered := *result
+	filtered.Endpoints = []discovery.Endpoint{}
+	for _, endpoint := range result.Endpoints {
+		if (hostname != "" && endpoint.Hostname == hostname) || (ip != "" && endpoint.IP == ip) {
+			continue
+		}
+		filtered.Endpoints = append(filtered.Endpoints, endpoint)
+	}
+	return &filtered
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// serveCommand is the subcommand that serves the endpoints over HTTP instead of discovering them once
+const serveCommand = "serve"
+
+// servePrefix is the path the endpoints are served under, followed by <namespace>/<service>
+const servePrefix = "/v1/endpoints/"
+
+var listenAddress = flag.String("listen-address", os.Getenv("ENDPOINT_LISTEN_ADDRESS"), "address the serve subcommand listens on, :8080 by default (env ENDPOINT_LISTEN_ADDRESS)")
+
+// parseCommand returns the serve, check or zookeeper-bootstrap subcommand when one was given,
+// removing it from the arguments so that the flags after it are parsed
+func parseCommand() string {
+	if len(os.Args) < 2 || (os.Args[1] != serveCommand && os.Args[1] != checkCommand && os.Args[1] != zookeeperBootstrapCommand) {
+		return ""
+	}
+	command := os.Args[1]
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	return command
+}
+
+// endpointServer answers the endpoint requests from the informer cache of the discoverer
+type endpointServer struct {
+	discoverer *discovery.Discoverer
+	s          *settings
+}
+
+// serveEndpoints keeps an informer cache of the endpoints of the namespace, or of every namespace
+// with -all-namespaces, and serves them until the context is done
+func serveEndpoints(ctx context.Context, discoverer *discovery.Discoverer, s *settings) {
+	cacheOptions := s.options
+	cacheOptions.Services = nil
+	if s.options.AllNamespaces {
+		cacheOptions.Namespace = metav1.NamespaceAll
+	}
+	if err := discoverer.StartCache(ctx, cacheOptions); err != nil {
+		log.Fatalf("Unable to serve the endpoints: %v", err)
+	}
+	server := &endpointServer{discoverer: discoverer, s: s}
+	if *grpcAddress != "" {
+		go serveGRPC(ctx, server, *grpcAddress)
+	}
+
+	address := *listenAddress
+	if address == "" {
+		address = ":8080"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(servePrefix, server.serveHTTP)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	httpServer := &http.Server{Addr: address, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+	log.Infof("Serving the endpoints on %s%s", address, servePrefix)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Unable to serve the endpoints on %s: %v", address, err)
+	}
+}
+
+// serves reports whether the endpoints of the namespace are in the cache
+func (e *endpointServer) serves(namespaceName string) bool {
+	return e.s.options.AllNamespaces || e.s.options.Namespace == "" || namespaceName == e.s.options.Namespace
+}
+
+// serveHTTP renders the endpoints of /v1/endpoints/<namespace>/<service> as JSON, or in the
+// format given by the format query parameter
+func (e *endpointServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, servePrefix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "expected "+servePrefix+"<namespace>/<service>", http.StatusNotFound)
+		return
+	}
+	if !e.serves(parts[0]) {
+		http.Error(w, "namespace "+parts[0]+" isn't served", http.StatusNotFound)
+		return
+	}
+	endpoints, err := e.discoverer.ServiceEndpoints(r.Context(), e.s.options, parts[0], parts[1])
+	if errors.IsNotFound(err) {
+		http.Error(w, "service "+parts[0]+"/"+parts[1]+" not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "json"
+	}
+	formatter, err := format.LookupWriter(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options := e.s.formatOptions
+	options.Zone = func(endpoint discovery.Endpoint) string {
+		return e.discoverer.EndpointZone(r.Context(), endpoint)
+	}
+	// rendered in full first, a failing format answering an error rather than a truncated body
+	var output bytes.Buffer
+	if err := formatter(&output, endpoints, options); err != nil {
+		log.Error("Unable to render the endpoints", "namespace", parts[0], "service", parts[1], "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if name == "json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Write(output.Bytes())
+}
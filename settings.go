@@ -0,0 +1,608 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// envPrefixRe matches the prefixes of the variables of the env format
+var envPrefixRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// settings holds the discovery configuration read from the environment
+type settings struct {
+	options       discovery.Options
+	formatOptions format.Options
+	resultFile    *os.File
+	redis         *redisPublisher
+	webhook       *webhookPublisher
+	jsonPath      *jsonpath.JSONPath
+	format        string
+	template      format.Formatter
+	command       format.Formatter
+	output        *outputFile
+	outputDir     *peerDirectory
+	membership    *membershipTracker
+	onChange      *changeHook
+	cacheFile     *endpointsCacheFile
+	waitFor       *waitCondition
+	configMap     *configMapTarget
+	leader        *leaderLease
+	readiness     *readinessCondition
+	picker        *endpointPicker
+	sinks         []*outputSink
+	contexts      []clusterContext
+	metrics       *metrics
+	dependency    *dependency
+	emitEvents    bool
+	mirrorTo      *mirrorTarget
+	validateDNS   string
+	excludeSelf   bool
+	selfHostname  string
+	domainAuto    bool
+	resultTTL     int
+	minRatio      float64
+}
+
+// publishesConfigMap reports whether the output or one of the -output sinks is written to a ConfigMap
+func (s *settings) publishesConfigMap() bool {
+	if s.configMap != nil {
+		return true
+	}
+	for _, sink := range s.sinks {
+		if sink.configMap != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// leaderLease returns the Lease elected on to write the shared outputs, nil without leader
+// election. -publish-leader-election is an alias of -leader-election-lease on the <name>-leader
+// Lease next to the published ConfigMap, so that a single election gates every shared output:
+// with both, the -leader-election-lease one.
+func (s *settings) leaderLease(lease string, publishLeaderElection bool) (*leaderLease, error) {
+	if lease != "" {
+		return parseLeaderLease(lease)
+	}
+	if !publishLeaderElection {
+		return nil, nil
+	}
+	target := s.configMap
+	for _, sink := range s.sinks {
+		if target != nil {
+			break
+		}
+		target = sink.configMap
+	}
+	if target == nil {
+		return nil, nil
+	}
+	return &leaderLease{namespaceName: target.namespaceName, name: target.name + "-leader"}, nil
+}
+
+// loadSettings reads and validates the ENDPOINT_* environment variables
+func loadSettings() *settings {
+	s := &settings{
+		options: discovery.Options{
+			Namespace:        *namespaceFlag,
+			Service:          *serviceFlag,
+			ServiceSelector:  *serviceSelector,
+			AllNamespaces:    *allNamespaces,
+			Domain:           *domainFlag,
+			Count:            *minEndpoints,
+			Timeout:          *timeout,
+			Interval:         *interval,
+			MaxInterval:      *maxInterval,
+			CountScope:       os.Getenv("ENDPOINT_COUNT_SCOPE"),
+			Sort:             *sortFlag,
+			WeightAnnotation: os.Getenv("ENDPOINT_WEIGHT_ANNOTATION"),
+			MemberAnnotation: os.Getenv("ENDPOINT_MEMBER_ANNOTATION"),
+			MemberValue:      os.Getenv("ENDPOINT_MEMBER_VALUE"),
+			NameStyle:        os.Getenv("ENDPOINT_NAME_STYLE"),
+			PortName:         *portNameFlag,
+			AddressType:      *addressType,
+			AddressFamily:    *addressFamily,
+			IncludeNotReady:  *includeNotReady,
+			Backend:          *backendFlag,
+			DNSTTL:           *dnsTTL,
+			LoadBalancer:     *loadBalancer,
+			SearchDomains:    strings.FieldsFunc(os.Getenv("ENDPOINT_SEARCH_DOMAINS"), func(r rune) bool { return r == ',' || r == ' ' }),
+		},
+		validateDNS: os.Getenv("ENDPOINT_VALIDATE_DNS"),
+		domainAuto:  os.Getenv("ENDPOINT_DOMAIN_AUTO") == "true",
+		format:      *formatFlag,
+	}
+	o := &s.options
+	if o.Namespace == "" {
+		if o.Namespace = discovery.DefaultNamespace(); o.Namespace != "" {
+			log.Infof("Using the pod namespace %s", o.Namespace)
+		}
+	}
+	if o.Domain == "" && !s.domainAuto {
+		if o.Domain = discovery.DefaultDomain(); o.Domain != "" {
+			log.Infof("Using the cluster domain %s from /etc/resolv.conf", o.Domain)
+		}
+	}
+	if *stats {
+		o.Stats = os.Stderr
+	}
+	s.formatOptions = format.Options{
+		GoType:             os.Getenv("ENDPOINT_GO_TYPE"),
+		GoVar:              os.Getenv("ENDPOINT_GO_VAR"),
+		GoStructured:       os.Getenv("ENDPOINT_GO_STRUCTURED") == "true",
+		SelfIP:             os.Getenv("POD_IP"),
+		EtcdScheme:         os.Getenv("ENDPOINT_ETCD_SCHEME"),
+		VaultScheme:        os.Getenv("ENDPOINT_VAULT_SCHEME"),
+		MinioScheme:        os.Getenv("ENDPOINT_MINIO_SCHEME"),
+		NatsScheme:         os.Getenv("ENDPOINT_NATS_SCHEME"),
+		ClickHouseCluster:  os.Getenv("ENDPOINT_CLICKHOUSE_CLUSTER"),
+		RedisMaster:        os.Getenv("ENDPOINT_REDIS_MASTER"),
+		PgHbaMethod:        os.Getenv("ENDPOINT_PG_HBA_METHOD"),
+		SolrChroot:         os.Getenv("ENDPOINT_SOLR_CHROOT"),
+		MinioPath:          os.Getenv("ENDPOINT_MINIO_PATH"),
+		MinioList:          os.Getenv("ENDPOINT_MINIO_EXPAND") == "false",
+		MongoReplicaSet:    os.Getenv("ENDPOINT_MONGODB_REPLICA_SET"),
+		ProxyName:          os.Getenv("ENDPOINT_PROXY_NAME"),
+		EnvPrefix:          os.Getenv("ENDPOINT_ENV_PREFIX"),
+		EnvoyCluster:       os.Getenv("ENDPOINT_ENVOY_CLUSTER"),
+		MinimumMasterNodes: os.Getenv("ENDPOINT_ES_MINIMUM_MASTER_NODES") == "true",
+		IndexOffset:        *indexOffset,
+		ReadySuffix:        *readySuffix,
+		NotReadySuffix:     *notReadySuffix,
+	}
+	if (*readySuffix != "" || *notReadySuffix != "") && !o.IncludeNotReady {
+		log.Fatalf("-ready-suffix and -not-ready-suffix require -include-not-ready")
+	}
+	if *ordinalRegex != "" {
+		re, err := regexp.Compile(*ordinalRegex)
+		if err != nil || re.NumSubexp() < 1 {
+			log.Fatalf("Invalid -ordinal-regex %q: must be a regex with a group capturing the ordinal", *ordinalRegex)
+		}
+		s.formatOptions.OrdinalRegex = re
+		s.options.OrdinalRegex = re
+	}
+	if value := os.Getenv("ENDPOINT_KAFKA_PORT"); value != "" {
+		s.formatOptions.KafkaPort = parsePort("ENDPOINT_KAFKA_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_ETCD_PEER_PORT"); value != "" {
+		s.formatOptions.EtcdPeerPort = parsePort("ENDPOINT_ETCD_PEER_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_VAULT_PORT"); value != "" {
+		s.formatOptions.VaultPort = parsePort("ENDPOINT_VAULT_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_MINIO_PORT"); value != "" {
+		s.formatOptions.MinioPort = parsePort("ENDPOINT_MINIO_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_PROXY_PORT"); value != "" {
+		s.formatOptions.ProxyPort = parsePort("ENDPOINT_PROXY_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_COCKROACHDB_PORT"); value != "" {
+		s.formatOptions.CockroachPort = parsePort("ENDPOINT_COCKROACHDB_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_COCKROACHDB_JOIN_LIMIT"); value != "" {
+		s.formatOptions.CockroachJoinLimit, err = strconv.Atoi(value)
+		if err != nil || s.formatOptions.CockroachJoinLimit < 0 {
+			log.Fatalf("Invalid ENDPOINT_COCKROACHDB_JOIN_LIMIT %q: must be a non-negative number", value)
+		}
+	}
+	if value := os.Getenv("ENDPOINT_NATS_PORT"); value != "" {
+		s.formatOptions.NatsPort = parsePort("ENDPOINT_NATS_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_HAZELCAST_PORT"); value != "" {
+		s.formatOptions.HazelcastPort = parsePort("ENDPOINT_HAZELCAST_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_IGNITE_PORT"); value != "" {
+		s.formatOptions.IgnitePort = parsePort("ENDPOINT_IGNITE_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_IGNITE_PORT_RANGE"); value != "" {
+		s.formatOptions.IgnitePortRange, err = strconv.Atoi(value)
+		if err != nil || s.formatOptions.IgnitePortRange < 0 {
+			log.Fatalf("Invalid ENDPOINT_IGNITE_PORT_RANGE %q: must be a non-negative number", value)
+		}
+	}
+	if value := os.Getenv("ENDPOINT_CLICKHOUSE_SHARDS"); value != "" {
+		s.formatOptions.ClickHouseShards, err = strconv.Atoi(value)
+		if err != nil || s.formatOptions.ClickHouseShards < 1 {
+			log.Fatalf("Invalid ENDPOINT_CLICKHOUSE_SHARDS %q: must be a positive number", value)
+		}
+	}
+	if value := os.Getenv("ENDPOINT_CLICKHOUSE_PORT"); value != "" {
+		s.formatOptions.ClickHousePort = parsePort("ENDPOINT_CLICKHOUSE_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_REDIS_PORT"); value != "" {
+		s.formatOptions.RedisPort = parsePort("ENDPOINT_REDIS_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_REDIS_QUORUM"); value != "" {
+		s.formatOptions.RedisQuorum, err = strconv.Atoi(value)
+		if err != nil || s.formatOptions.RedisQuorum < 1 {
+			log.Fatalf("Invalid ENDPOINT_REDIS_QUORUM %q: must be a positive number", value)
+		}
+	}
+	if value := os.Getenv("ENDPOINT_REDIS_CLUSTER_REPLICAS"); value != "" {
+		s.formatOptions.RedisClusterReplicas, err = strconv.Atoi(value)
+		if err != nil || s.formatOptions.RedisClusterReplicas < 0 {
+			log.Fatalf("Invalid ENDPOINT_REDIS_CLUSTER_REPLICAS %q: must be a non-negative number", value)
+		}
+	}
+	if value := os.Getenv("ENDPOINT_PATRONI_PORT"); value != "" {
+		s.formatOptions.PatroniPort = parsePort("ENDPOINT_PATRONI_PORT", value)
+	}
+	if value := os.Getenv("ENDPOINT_CASSANDRA_SEEDS"); value != "" {
+		s.formatOptions.CassandraSeeds, err = strconv.Atoi(value)
+		if err != nil || s.formatOptions.CassandraSeeds < 0 {
+			log.Fatalf("Invalid ENDPOINT_CASSANDRA_SEEDS %q: must be a non-negative number", value)
+		}
+	}
+	if scheme := s.formatOptions.EtcdScheme; scheme != "" && scheme != "http" && scheme != "https" {
+		log.Fatalf("Invalid ENDPOINT_ETCD_SCHEME %q: must be http or https", scheme)
+	}
+	if scheme := s.formatOptions.VaultScheme; scheme != "" && scheme != "http" && scheme != "https" {
+		log.Fatalf("Invalid ENDPOINT_VAULT_SCHEME %q: must be http or https", scheme)
+	}
+	if scheme := s.formatOptions.MinioScheme; scheme != "" && scheme != "http" && scheme != "https" {
+		log.Fatalf("Invalid ENDPOINT_MINIO_SCHEME %q: must be http or https", scheme)
+	}
+	if scheme := s.formatOptions.NatsScheme; scheme != "" && scheme != "nats" && scheme != "tls" {
+		log.Fatalf("Invalid ENDPOINT_NATS_SCHEME %q: must be nats or tls", scheme)
+	}
+	if prefix := s.formatOptions.EnvPrefix; prefix != "" && !envPrefixRe.MatchString(prefix) {
+		log.Fatalf("Invalid ENDPOINT_ENV_PREFIX %q: must be an environment variable name", prefix)
+	}
+
+	if o.ServiceSelector != "" {
+		if _, err := labels.Parse(o.ServiceSelector); err != nil {
+			log.Fatalf("Invalid -service-selector %q: %v", o.ServiceSelector, err)
+		}
+	}
+	if strings.ContainsAny(o.Service, ",/") {
+		o.Services, err = discovery.ParseServiceRefs(o.Service, o.Namespace)
+		if err != nil {
+			log.Fatalf("Invalid -service %q: %v", o.Service, err)
+		}
+		// the first service still names the default format and the events object
+		o.Service = o.Services[0].Name
+		if o.Namespace == "" {
+			o.Namespace = o.Services[0].Namespace
+		}
+	}
+	if expr := os.Getenv("ENDPOINT_SERVICE_REGEX"); expr != "" {
+		o.ServiceRegex, err = regexp.Compile(expr)
+		if err != nil {
+			log.Fatalf("Invalid ENDPOINT_SERVICE_REGEX %q: %v", expr, err)
+		}
+	}
+	if o.CountScope != "" && o.CountScope != "aggregate" && o.CountScope != "per-service" {
+		log.Fatalf("Invalid ENDPOINT_COUNT_SCOPE %q: must be aggregate or per-service", o.CountScope)
+	}
+	switch o.Sort {
+	case "", "ordinal", "hostname", "ip", "none", "weight", "first-seen":
+	default:
+		log.Fatalf("Invalid -sort %q: must be ordinal, hostname, ip, none, weight or first-seen", o.Sort)
+	}
+	o.Zone = *zoneFlag
+	if *probePort != "" {
+		o.ProbePort = parsePort("-probe-port", *probePort)
+		o.ProbeTimeout = *probeTimeout
+		o.ProbeMode = os.Getenv("ENDPOINT_PROBE_MODE")
+		if o.ProbeMode != "" && o.ProbeMode != "wait" && o.ProbeMode != "exclude" {
+			log.Fatalf("Invalid ENDPOINT_PROBE_MODE %q: must be wait or exclude", o.ProbeMode)
+		}
+	}
+	if *limitFlag < 0 || *skipFlag < 0 {
+		log.Fatalf("-limit and -skip can't be negative")
+	}
+	switch *pickFlag {
+	case "":
+	case "first", "random", "lowest-ordinal":
+		s.picker = &endpointPicker{mode: *pickFlag, ordinalRegex: s.formatOptions.OrdinalRegex}
+	default:
+		log.Fatalf("Invalid -pick %q: must be first, random or lowest-ordinal", *pickFlag)
+	}
+	if *excludeSelf {
+		s.excludeSelf = true
+		s.selfHostname = selfHostname()
+	}
+	if *podSelector != "" {
+		if o.PodSelector, err = labels.Parse(*podSelector); err != nil {
+			log.Fatalf("Invalid -pod-selector %q: %v", *podSelector, err)
+		}
+		if o.AddressType == "" {
+			o.AddressType = "ip"
+		}
+	}
+	if *nodeSelector != "" {
+		if o.NodeSelector, err = labels.Parse(*nodeSelector); err != nil {
+			log.Fatalf("Invalid -node-selector %q: %v", *nodeSelector, err)
+		}
+	}
+	if value := os.Getenv("ENDPOINT_PORT_NUMBER"); value != "" {
+		o.PortNumber = parsePort("ENDPOINT_PORT_NUMBER", value)
+	}
+	if s.validateDNS != "" && s.validateDNS != "warn" && s.validateDNS != "strict" {
+		log.Fatalf("Invalid ENDPOINT_VALIDATE_DNS %q: must be warn or strict", s.validateDNS)
+	}
+	switch o.AddressType {
+	case "", "hostname", "ip", "auto":
+	default:
+		log.Fatalf("Invalid -address-type %q: must be hostname, ip or auto", o.AddressType)
+	}
+	switch o.AddressFamily {
+	case "", "ipv4", "ipv6", "dual":
+	default:
+		log.Fatalf("Invalid -address-family %q: must be ipv4, ipv6 or dual", o.AddressFamily)
+	}
+	if *hostnameSource != "" {
+		if o.HostnameSources, err = discovery.ParseHostnameSources(*hostnameSource); err != nil {
+			log.Fatalf("Invalid -hostname-source %q: %v", *hostnameSource, err)
+		}
+	}
+	if o.NameStyle != "" && o.NameStyle != "fqdn" && o.NameStyle != "search" {
+		log.Fatalf("Invalid ENDPOINT_NAME_STYLE %q: must be fqdn or search", o.NameStyle)
+	}
+	if o.NameStyle == "search" && len(o.SearchDomains) == 0 {
+		log.Warningf("ENDPOINT_NAME_STYLE=search without ENDPOINT_SEARCH_DOMAINS, emitting full FQDNs")
+	}
+	if o.MemberAnnotation != "" && o.MemberValue == "" {
+		o.MemberValue = "true"
+	}
+	if o.WeightAnnotation == "" {
+		o.WeightAnnotation = "endpoint-discovery.io/weight"
+	}
+	if *minRatio != "" {
+		s.minRatio, err = strconv.ParseFloat(*minRatio, 64)
+		if err != nil || s.minRatio <= 0 || s.minRatio > 1 {
+			log.Fatalf("Invalid -min-ratio %q: must be a fraction between 0 and 1", *minRatio)
+		}
+	}
+	if value := os.Getenv("ENDPOINT_WEIGHT_DEFAULT"); value != "" {
+		o.WeightDefault, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("Invalid ENDPOINT_WEIGHT_DEFAULT %q: %v", value, err)
+		}
+	}
+	o.PageSize = 500
+	if value := os.Getenv("ENDPOINT_PAGE_SIZE"); value != "" {
+		o.PageSize, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || o.PageSize < 0 {
+			log.Fatalf("Invalid ENDPOINT_PAGE_SIZE %q: must be a non-negative number", value)
+		}
+	}
+	if value := os.Getenv("ENDPOINT_MIRROR_TO"); value != "" {
+		s.mirrorTo = parseMirrorTarget(value)
+	}
+	if value := os.Getenv("ENDPOINT_DEPENDS_ON"); value != "" {
+		s.dependency = parseDependency(value, o.Namespace)
+	}
+	if os.Getenv("ENDPOINT_EMIT_EVENTS") == "true" {
+		if o.Service == "" {
+			log.Warningf("ENDPOINT_EMIT_EVENTS requires ENDPOINT_SERVICE_NAME to reference a Service, events are disabled")
+		} else {
+			s.emitEvents = true
+		}
+	}
+	if *jsonPathExpr != "" {
+		s.jsonPath = parseJSONPath(*jsonPathExpr)
+	}
+	if command := strings.TrimPrefix(s.format, "exec:"); command != s.format {
+		if s.command, err = format.NewCommand(command); err != nil {
+			log.Fatalf("Invalid -format %q: %v", s.format, err)
+		}
+	} else if s.format != "" {
+		if _, err := format.Lookup(s.format); err != nil {
+			log.Fatalf("Invalid -format %q: %v", s.format, err)
+		}
+	}
+	if *templateText != "" {
+		s.template, err = format.NewTemplate(*templateText)
+		if err != nil {
+			log.Fatalf("Invalid -template: %v", err)
+		}
+	}
+	if *validateTemplate && s.template == nil {
+		log.Fatalf("-validate-template requires -template")
+	}
+	if o.Timeout <= 0 || o.Interval <= 0 || o.MaxInterval <= 0 {
+		log.Fatalf("-timeout, -interval and -max-interval must be positive")
+	}
+	if *kubeAPIQPS < 0 || *kubeAPIBurst < 0 {
+		log.Fatalf("-kube-api-qps and -kube-api-burst can't be negative")
+	}
+	if *execMode {
+		if flag.NArg() == 0 {
+			log.Fatalf("-exec requires a command after the flags")
+		}
+		if *hold || *watchMode {
+			log.Fatalf("-exec can't be combined with -hold or -watch")
+		}
+	}
+	if *apiServer != "" && *contexts != "" {
+		log.Fatalf("-server can't be combined with -contexts")
+	}
+	if *contexts != "" {
+		if *hold || *watchMode {
+			log.Fatalf("-contexts can't be combined with -hold or -watch")
+		}
+		s.contexts = parseContexts(*contexts)
+	}
+	if *waitFor != "" {
+		s.waitFor = parseWaitFor(*waitFor)
+		o.CountOp = s.waitFor.op
+		if s.waitFor.statefulSet == "" {
+			o.Count = s.waitFor.count
+		}
+	}
+	if *cacheFile != "" {
+		s.cacheFile = newEndpointsCacheFile(*cacheFile, *maxCacheAge)
+	} else if *maxCacheAge != 0 {
+		log.Fatalf("-max-cache-age requires -cache-file")
+	}
+	if *debounce < 0 {
+		log.Fatalf("-debounce can't be negative")
+	}
+	if *debounce > 0 && !*hold && !*watchMode {
+		log.Fatalf("-debounce requires -hold or -watch")
+	}
+	if *writeDebounce < 0 {
+		log.Fatalf("-write-debounce can't be negative")
+	}
+	if *writeDebounce > 0 && !*hold && !*watchMode {
+		log.Fatalf("-write-debounce requires -hold or -watch")
+	}
+	if *onChange != "" {
+		if !*hold && !*watchMode {
+			log.Fatalf("-on-change requires -hold or -watch")
+		}
+		s.onChange = newChangeHook(*onChange, *onChangeDebounce, *onChangeMinInterval)
+	}
+	if *publishConfigMap != "" {
+		if s.configMap, err = parseConfigMapTarget(*publishConfigMap); err != nil {
+			log.Fatalf("Invalid -publish-configmap %q: %v", *publishConfigMap, err)
+		}
+	}
+	if *outputSinks != "" {
+		s.sinks = parseOutputSinks(*outputSinks)
+	}
+	if *publishLeaderElection && !*hold && !*watchMode && s.publishesConfigMap() {
+		log.Fatalf("-publish-leader-election requires -hold or -watch")
+	}
+	if *readinessGate != "" {
+		s.readiness = newReadinessCondition(*readinessGate, o.Namespace)
+	}
+	if *leaderElectionLease != "" && !*hold && !*watchMode {
+		log.Fatalf("-leader-election-lease requires -hold or -watch")
+	}
+	if s.leader, err = s.leaderLease(*leaderElectionLease, *publishLeaderElection); err != nil {
+		log.Fatalf("Invalid -leader-election-lease %q: %v", *leaderElectionLease, err)
+	}
+	if *metricsAddress != "" {
+		s.metrics = &metrics{}
+		o.OnPoll = s.metrics.observe
+		s.metrics.serve(*metricsAddress)
+	}
+	if *watchEvents {
+		if !*hold && !*watchMode {
+			log.Fatalf("-watch-events requires -hold or -watch")
+		}
+		s.membership = newMembershipTracker()
+	}
+	if *outputDir != "" {
+		s.outputDir = newPeerDirectory(*outputDir)
+	}
+	if *outputPath != "" {
+		s.output = newOutputFile(*outputPath, *reloadSignal, *reloadPid, *reloadPidFile)
+	} else if *reloadPid != 0 || *reloadPidFile != "" {
+		log.Fatalf("-reload-pid and -reload-pidfile require -output-file")
+	}
+	switch *outputCompress {
+	case "":
+	case "gzip":
+		compressed := 0
+		if s.output != nil {
+			s.output.gzip = true
+			compressed++
+		}
+		if s.configMap != nil {
+			s.configMap.gzip = true
+			compressed++
+		}
+		for _, sink := range s.sinks {
+			switch {
+			case sink.file != nil:
+				sink.file.gzip = true
+				compressed++
+			case sink.configMap != nil:
+				sink.configMap.gzip = true
+				compressed++
+			}
+		}
+		if compressed == 0 {
+			log.Fatalf("-output-compress requires -output-file, -publish-configmap or a file or ConfigMap -output, stdout isn't compressed")
+		}
+	default:
+		log.Fatalf("Invalid -output-compress %q: must be gzip", *outputCompress)
+	}
+	if *writeIfChanged {
+		files := []*outputFile{}
+		if s.output != nil {
+			files = append(files, s.output)
+		}
+		for _, sink := range s.sinks {
+			if sink.file != nil {
+				files = append(files, sink.file)
+			}
+		}
+		if len(files) == 0 {
+			log.Fatalf("-write-if-changed requires -output-file or a file -output")
+		}
+		for _, file := range files {
+			file.ifChanged = true
+		}
+	}
+	if value := os.Getenv("ENDPOINT_REDIS_URL"); value != "" {
+		s.redis = newRedisPublisher(value, os.Getenv("ENDPOINT_REDIS_KEY"), os.Getenv("ENDPOINT_REDIS_MODE"))
+	}
+	if *webhookURL != "" {
+		s.webhook = newWebhookPublisher(*webhookURL, os.Getenv("ENDPOINT_WEBHOOK_SECRET"))
+	}
+	switch o.Backend {
+	case "":
+		o.Backend = discovery.BackendEndpoints
+	case discovery.BackendEndpoints, discovery.BackendEndpointSlices, discovery.BackendAuto, discovery.BackendDNS:
+	default:
+		log.Fatalf("Invalid -backend %q: must be endpoints, endpointslices, auto or dns", o.Backend)
+	}
+	if o.Backend == discovery.BackendDNS && (o.ServiceSelector != "" || o.ServiceRegex != nil) {
+		log.Fatalf("-backend dns can't be combined with -service-selector or ENDPOINT_SERVICE_REGEX")
+	}
+	if o.Backend == discovery.BackendDNS && (o.Zone != "" || o.NodeSelector != nil) {
+		log.Fatalf("-backend dns can't be combined with -zone or -node-selector, DNS records have no nodes")
+	}
+	if o.DNSTTL && (o.Backend != discovery.BackendDNS || !(*watchMode || *hold)) {
+		log.Fatalf("-dns-ttl requires -backend dns and -watch or -hold")
+	}
+	if *readAnnotations && (o.Service == "" || len(o.Services) > 0 || discovery.ListsServices(*o)) {
+		log.Fatalf("-read-annotations requires -service to name a single service")
+	}
+	if o.LoadBalancer && (o.Backend == discovery.BackendDNS || o.PodSelector != nil || o.Zone != "" || o.NodeSelector != nil) {
+		log.Fatalf("-load-balancer can't be combined with -backend dns, -pod-selector, -zone or -node-selector")
+	}
+	if o.PodSelector != nil && (o.Backend == discovery.BackendDNS || discovery.ListsServices(*o) || len(o.Services) > 0) {
+		log.Fatalf("-pod-selector can't be combined with -backend dns, -service-selector, ENDPOINT_SERVICE_REGEX, -all-namespaces or several services")
+	}
+	if o.AllNamespaces && len(o.Services) > 0 {
+		log.Fatalf("-all-namespaces can't be combined with a list of [namespace/]service references")
+	}
+	if *fromFile != "" {
+		validateFixture(s)
+	}
+	s.resultTTL = resultTTL(*hold || *watchMode, *interval, *maxInterval, *writeDebounce)
+	if value := os.Getenv("ENDPOINT_RESULT_TTL"); value != "" {
+		s.resultTTL, err = strconv.Atoi(value)
+		if err != nil || s.resultTTL < 0 {
+			log.Fatalf("Invalid ENDPOINT_RESULT_TTL %q: must be a number of seconds", value)
+		}
+	}
+	s.formatOptions.ResultTTL = s.resultTTL
+	if value := os.Getenv("ENDPOINT_RESULT_FD"); value != "" {
+		s.resultFile = openResultFd(value)
+	}
+	return s
+}
+
+// parsePort validates a port number read from the environment variable
+func parsePort(name string, value string) int32 {
+	number, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || number < 1 || number > 65535 {
+		log.Fatalf("Invalid %s %q: must be a port number", name, value)
+	}
+	return int32(number)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+	"k8s.io/client-go/kubernetes"
+)
+
+// outputSink is an additional output rendered in its own format and written to stdout, a file
+// or a ConfigMap, besides the main output
+type outputSink struct {
+	spec      string
+	formatter format.Formatter
+	file      *outputFile
+	configMap *configMapTarget
+	// port keeps only the endpoints exposing the named port when set
+	port string
+}
+
+// parseOutputSinks parses the semicolon-separated groups of sinks. A group is either a
+// comma-separated list of <format>=<destination> sinks, the format being a format name,
+// template:<path> to a template file or exec:<command>, and the destination - for stdout,
+// configmap:namespace/name[:key] or a file path, or a single sink given by key=value fields.
+func parseOutputSinks(value string) []*outputSink {
+	sinks := []*outputSink{}
+	for _, group := range strings.Split(value, ";") {
+		if isFieldSink(group) {
+			sinks = append(sinks, parseFieldSink(strings.TrimSpace(group)))
+			continue
+		}
+		for _, spec := range strings.Split(group, ",") {
+			spec = strings.TrimSpace(spec)
+			if spec == "" {
+				continue
+			}
+			parts := strings.SplitN(spec, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				log.Fatalf("Invalid -output %q: must be <format>=<destination>", spec)
+			}
+			sinks = append(sinks, newOutputSink(spec, parts[0], parts[1]))
+		}
+	}
+	return sinks
+}
+
+// sinkFields are the keys of a sink given by fields, none of them being a format name
+var sinkFields = map[string]bool{"format": true, "port": true, "file": true, "configmap": true}
+
+// isFieldSink reports whether the group is a sink given by key=value fields
+func isFieldSink(group string) bool {
+	field := strings.SplitN(strings.TrimSpace(group), ",", 2)[0]
+	return sinkFields[strings.SplitN(field, "=", 2)[0]]
+}
+
+// parseFieldSink parses a sink given by comma-separated format=, port=, and file= or configmap=
+// fields, written to stdout without a destination. With port, only the endpoints exposing the
+// named port are rendered, with that port alone.
+func parseFieldSink(spec string) *outputSink {
+	fields := map[string]string{}
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 || !sinkFields[parts[0]] || parts[1] == "" {
+			log.Fatalf("Invalid -output %q: %q must be format=, port=, file= or configmap=", spec, field)
+		}
+		if _, ok := fields[parts[0]]; ok {
+			log.Fatalf("Invalid -output %q: %s is given twice", spec, parts[0])
+		}
+		fields[parts[0]] = parts[1]
+	}
+	if fields["format"] == "" {
+		log.Fatalf("Invalid -output %q: requires format=", spec)
+	}
+	destination := "-"
+	switch {
+	case fields["file"] != "" && fields["configmap"] != "":
+		log.Fatalf("Invalid -output %q: file= and configmap= are mutually exclusive", spec)
+	case fields["file"] != "":
+		destination = fields["file"]
+	case fields["configmap"] != "":
+		destination = "configmap:" + fields["configmap"]
+	}
+	sink := newOutputSink(spec, fields["format"], destination)
+	sink.port = fields["port"]
+	return sink
+}
+
+// newOutputSink creates the sink rendering the format to the destination
+func newOutputSink(spec string, name string, destination string) *outputSink {
+	sink := &outputSink{spec: spec}
+	var err error
+	if path := strings.TrimPrefix(name, "template:"); path != name {
+		var text []byte
+		if text, err = ioutil.ReadFile(path); err != nil {
+			log.Fatalf("Invalid -output %q: %v", spec, err)
+		}
+		sink.formatter, err = format.NewTemplate(string(text))
+	} else if command := strings.TrimPrefix(name, "exec:"); command != name {
+		sink.formatter, err = format.NewCommand(command)
+	} else {
+		sink.formatter, err = format.Lookup(name)
+	}
+	if err != nil {
+		log.Fatalf("Invalid -output %q: %v", spec, err)
+	}
+	switch {
+	case destination == "-":
+	case strings.HasPrefix(destination, "configmap:"):
+		if sink.configMap, err = parseConfigMapTarget(strings.TrimPrefix(destination, "configmap:")); err != nil {
+			log.Fatalf("Invalid -output %q: %v", spec, err)
+		}
+	default:
+		sink.file = &outputFile{path: destination}
+	}
+	return sink
+}
+
+// startOutputSinks sets the client the ConfigMap sinks are written with
+func startOutputSinks(clientset kubernetes.Interface, sinks []*outputSink) {
+	for _, sink := range sinks {
+		if sink.configMap != nil {
+			sink.configMap.start(clientset)
+		}
+	}
+}
+
+// write renders the endpoints in the format of the sink and writes them to its destination
+func (sink *outputSink) write(ctx context.Context, endpoints []discovery.Endpoint, options format.Options) {
+	if sink.port != "" {
+		var err error
+		if endpoints, err = discovery.FilterPort(endpoints, sink.port); err != nil {
+			log.Errorf("Unable to render the -output %q: %v", sink.spec, err)
+			return
+		}
+	}
+	output, err := sink.formatter(endpoints, options)
+	if err != nil {
+		log.Errorf("Unable to render the -output %q: %v", sink.spec, err)
+		return
+	}
+	switch {
+	case sink.configMap != nil:
+		sink.configMap.publish(ctx, output)
+	case sink.file != nil:
+		sink.file.write(output)
+	default:
+		fmt.Print(output)
+	}
+}
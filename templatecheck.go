@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+var validateTemplate = flag.Bool("validate-template", false, "render -template with sample endpoints, or the endpoints of -from-file, print the output and exit, with 1 when the rendering fails")
+
+// renderTemplateAndExit renders -template with the endpoints, whether or not they meet the
+// expected count, and exits
+func renderTemplateAndExit(s *settings, endpoints []discovery.Endpoint) {
+	output, err := s.template(endpoints, s.formatOptions)
+	if err != nil {
+		log.Fatalf("Invalid -template: %v", err)
+	}
+	fmt.Print(output)
+	os.Exit(0)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// validateNames resolves each endpoint name and checks that it points at the endpoint IP,
+// returning the number of names that don't
+func validateNames(endpoints []discovery.Endpoint) int {
+	mismatches := 0
+	for _, endpoint := range endpoints {
+		addrs, err := net.LookupHost(endpoint.FQDN)
+		if err != nil {
+			log.Warningf("DNS validation: unable to resolve %s: %v", endpoint.FQDN, err)
+			mismatches++
+			continue
+		}
+		found := false
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip != nil && ip.Equal(net.ParseIP(endpoint.IP)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Warningf("DNS validation: %s resolves to %v, expected %s", endpoint.FQDN, addrs, endpoint.IP)
+			mismatches++
+		}
+	}
+	return mismatches
+}
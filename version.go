@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// version, commit and buildDate are set at build time with
+// -ldflags "-X main.version=<version> -X main.commit=<sha> -X main.buildDate=<date>"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+var showVersion = flag.Bool("version", false, "print the version, commit and build date of the tool and the version of its Kubernetes client, then exit")
+
+// buildCommit returns the commit set at build time, or the one recorded by the Go toolchain when
+// building from a checkout
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// clientVersion returns the version of the client-go module the tool was built with
+func clientVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "k8s.io/client-go" {
+				if dep.Replace != nil {
+					return dep.Replace.Version
+				}
+				return dep.Version
+			}
+		}
+	}
+	return "unknown"
+}
+
+// userAgent identifies the tool and its version in the API server audit logs
+func userAgent() string {
+	shortCommit := buildCommit()
+	if len(shortCommit) > 12 {
+		shortCommit = shortCommit[:12]
+	}
+	return fmt.Sprintf("kube-endpoint-discovery/%s (%s/%s) %s", version, runtime.GOOS, runtime.GOARCH, shortCommit)
+}
+
+// printVersion prints the tool version, commit and build date along with the client-go and Go
+// versions it was built with
+func printVersion() {
+	date := buildDate
+	if date == "" {
+		date = "unknown"
+	}
+	fmt.Fprintf(os.Stdout, "kube-endpoint-discovery %s\ncommit: %s\nbuilt: %s\nclient-go: %s\ngo: %s\n", version, buildCommit(), date, clientVersion(), runtime.Version())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// waitCondition is a parsed -wait-for expression
+type waitCondition struct {
+	// statefulSet is the statefulset/<name> or auto reference the count is taken from, empty for
+	// a fixed count
+	statefulSet string
+	op          string
+	count       int
+	// quorum waits for the majority of the StatefulSet replicas instead of all of them
+	quorum bool
+}
+
+// parseWaitFor parses a -wait-for expression: >=N or ==N for a fixed count, all (or auto) or
+// statefulset/<name> for exactly the replicas of the StatefulSet, governing the service for all,
+// and quorum for at least their majority
+func parseWaitFor(value string) *waitCondition {
+	for _, op := range []string{discovery.CountAtLeast, discovery.CountExactly} {
+		if number := strings.TrimPrefix(value, op); number != value {
+			count, err := strconv.Atoi(strings.TrimSpace(number))
+			if err != nil || count < 1 {
+				log.Fatalf("Invalid -wait-for %q: %s must be followed by a positive number", value, op)
+			}
+			return &waitCondition{op: op, count: count}
+		}
+	}
+	switch {
+	case value == "all" || value == "auto":
+		return &waitCondition{statefulSet: "auto", op: discovery.CountExactly}
+	case value == "quorum":
+		return &waitCondition{statefulSet: "auto", op: discovery.CountAtLeast, quorum: true}
+	case strings.HasPrefix(value, "statefulset/") || strings.HasPrefix(value, "sts/"):
+		return &waitCondition{statefulSet: value, op: discovery.CountExactly}
+	}
+	log.Fatalf("Invalid -wait-for %q: must be >=N, ==N, all, quorum or statefulset/<name>", value)
+	return nil
+}
+
+// resolve sets the expected count of the discovery from the StatefulSet replicas
+func (c *waitCondition) resolve(ctx context.Context, discoverer *discovery.Discoverer, o *discovery.Options) {
+	replicas, err := discoverer.StatefulSetReplicas(ctx, o.Namespace, o.Service, c.statefulSet)
+	if err != nil {
+		log.Fatalf("Invalid -wait-for %q: %v", *waitFor, err)
+	}
+	if c.quorum {
+		o.Count = format.Quorum(replicas)
+		log.Infof("Waiting for a quorum of %d of the %d replicas", o.Count, replicas)
+		return
+	}
+	log.Infof("Waiting for the %d replicas of %s", replicas, c.statefulSet)
+	o.Count = replicas
+}
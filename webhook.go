@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// webhookSignatureHeader carries the hex HMAC-SHA256 of the body when ENDPOINT_WEBHOOK_SECRET is set
+const webhookSignatureHeader = "X-Endpoint-Discovery-Signature"
+
+// webhookPublisher POSTs the results to a webhook from a background goroutine, so that a slow or
+// unavailable receiver never blocks discovery.
+type webhookPublisher struct {
+	url     string
+	secret  []byte
+	client  *http.Client
+	updates chan []byte
+	done    chan struct{}
+}
+
+// newWebhookPublisher validates the URL and starts the publisher
+func newWebhookPublisher(rawURL string, secret string) *webhookPublisher {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Fatalf("Invalid -webhook-url %q: must be an http or https URL", rawURL)
+	}
+	p := &webhookPublisher{
+		url:     rawURL,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		updates: make(chan []byte, 1),
+		done:    make(chan struct{}),
+	}
+	if secret != "" {
+		p.secret = []byte(secret)
+	}
+	go p.run()
+	return p
+}
+
+// publish queues the result, replacing any result that hasn't been sent yet
+func (p *webhookPublisher) publish(data []byte) {
+	for {
+		select {
+		case p.updates <- data:
+			return
+		default:
+			select {
+			case <-p.updates:
+			default:
+			}
+		}
+	}
+}
+
+// close waits for the queued result to be sent
+func (p *webhookPublisher) close() {
+	close(p.updates)
+	<-p.done
+}
+
+func (p *webhookPublisher) run() {
+	defer close(p.done)
+	for data := range p.updates {
+		for attempt := 1; attempt <= 5; attempt++ {
+			retry, err := p.send(data)
+			if err == nil {
+				log.Infof("Posted the endpoints to the webhook")
+				break
+			}
+			log.Warningf("Unable to post to the webhook (attempt %d): %v", attempt, err)
+			if !retry {
+				break
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+}
+
+// send POSTs a single result, reporting whether a failure is worth retrying
+func (p *webhookPublisher) send(data []byte) (bool, error) {
+	request, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if p.secret != nil {
+		mac := hmac.New(sha256.New, p.secret)
+		mac.Write(data)
+		request.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	// client errors other than throttling won't succeed on a retry
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("%s", response.Status)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/discovery"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/format"
+	"github.com/IvanovOleg/kube-endpoint-discovery/pkg/log"
+)
+
+// zookeeperBootstrapCommand is the subcommand that writes the configuration files of a ZooKeeper
+// server from the discovered ensemble, run as an init container
+const zookeeperBootstrapCommand = "zookeeper-bootstrap"
+
+var zookeeperDir = flag.String("zookeeper-dir", os.Getenv("ENDPOINT_ZOOKEEPER_DIR"), "directory the zookeeper-bootstrap subcommand writes zoo.cfg, myid and zoo.cfg.dynamic to (env ENDPOINT_ZOOKEEPER_DIR)")
+var zookeeperBaseConfig = flag.String("zookeeper-base-config", os.Getenv("ENDPOINT_ZOOKEEPER_BASE_CONFIG"), "zoo.cfg the zookeeper-bootstrap subcommand adds the server list to, without its server and dynamicConfigFile lines (env ENDPOINT_ZOOKEEPER_BASE_CONFIG)")
+var zookeeperDynamic = flag.Bool("zookeeper-dynamic", os.Getenv("ENDPOINT_ZOOKEEPER_DYNAMIC") == "true", "with zookeeper-bootstrap, write the server list to the zoo.cfg.dynamic file of ZooKeeper 3.5+ referenced by zoo.cfg (env ENDPOINT_ZOOKEEPER_DYNAMIC)")
+
+// bootstrapZookeeper writes zoo.cfg with the server list of the discovered ensemble, or with
+// -zookeeper-dynamic a reference to zoo.cfg.dynamic holding it, and the myid of the local pod,
+// to -zookeeper-myid-file or the directory
+func bootstrapZookeeper(ctx context.Context, discoverer *discovery.Discoverer, result *discovery.Result, s *settings) {
+	if *myIDFile == "" {
+		writeMyID(filepath.Join(*zookeeperDir, "myid"), s.formatOptions)
+	}
+	options := s.formatOptions
+	options.Zone = func(endpoint discovery.Endpoint) string {
+		return discoverer.EndpointZone(ctx, endpoint)
+	}
+	config := readBaseConfig(*zookeeperBaseConfig)
+	if *zookeeperDynamic {
+		dynamicPath := filepath.Join(*zookeeperDir, "zoo.cfg.dynamic")
+		writeZookeeperFile(dynamicPath, renderZookeeper(result, options, "zookeeper-dynamic"))
+		config += "dynamicConfigFile=" + dynamicPath + "\n"
+	} else {
+		config += renderZookeeper(result, options, "zookeeper")
+	}
+	writeZookeeperFile(filepath.Join(*zookeeperDir, "zoo.cfg"), config)
+}
+
+// readBaseConfig returns the lines of the base zoo.cfg but the server list, empty without one
+func readBaseConfig(path string) string {
+	if path == "" {
+		return ""
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Invalid -zookeeper-base-config: %v", err)
+	}
+	config := ""
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "server.") || strings.HasPrefix(trimmed, "dynamicConfigFile") {
+			continue
+		}
+		config += line + "\n"
+	}
+	return config
+}
+
+// renderZookeeper renders the endpoints in the zookeeper format of the name
+func renderZookeeper(result *discovery.Result, options format.Options, name string) string {
+	output, err := formatOutput(result, options, name)
+	if err != nil {
+		log.Fatalf("Unable to render the output: %v", err)
+	}
+	return output
+}
+
+func writeZookeeperFile(path string, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		log.Fatalf("Unable to write %s: %v", path, err)
+	}
+	log.Infof("Wrote %s", path)
+}
+
+// writeMyID writes the ZooKeeper myid file of the local pod, its ordinal plus one
+// so that it matches the server ids of the zookeeper formats
+func writeMyID(path string, options format.Options) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("Unable to read the hostname: %v", err)
+	}
+	ordinal := discovery.ParseOrdinal(hostname, options.OrdinalRegex)
+	if ordinal < 0 {
+		log.Fatalf("Unable to write %s: unable to find the ordinal in hostname %s", path, hostname)
+	}
+	id := ordinal + 1 + options.IndexOffset
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(id)+"\n"), 0644); err != nil {
+		log.Fatalf("Unable to write %s: %v", path, err)
+	}
+	log.Infof("Wrote myid %d to %s", id, path)
+}